@@ -0,0 +1,176 @@
+package discobolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// BatchRequest is used to define a single sub-request within a batch.
+type BatchRequest struct {
+	// Method is the HTTP method of the sub-request. Defaults to GET.
+	Method string `json:"method"`
+
+	// Path is the path (and optionally the query string) of the sub-request.
+	Path string `json:"path"`
+
+	// Headers are any additional headers to send with the sub-request.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Body is the JSON body of the sub-request.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchResponse is used to define the result of a single sub-request within a batch.
+type BatchResponse struct {
+	// Status is the HTTP status code of the sub-request.
+	Status int `json:"status"`
+
+	// Headers are the response headers of the sub-request. Each header has all of its values, so that several
+	// Set-Cookie headers are kept.
+	Headers map[string][]string `json:"headers,omitempty"`
+
+	// Body is the body of the sub-request. If the sub-request did not respond with JSON, this is a JSON string.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// Defines the default maximum number of sub-requests in a batch.
+const defaultMaxBatchSize = 20
+
+// Defines the context key that marks a request as a batch sub-request.
+type batchRequestKey struct{}
+
+// Defines the forwarding headers that say who the client is and how they connected. These (and the headers known
+// proxies put the real IP in) are copied from the batch request rather than the sub-request, so a client can't use a
+// sub-request to claim to be someone else.
+var batchForwardingHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Real-Ip",
+}
+
+// Checks if the header says who the client is or how they connected.
+func isIdentityHeader(key string) bool {
+	key = http.CanonicalHeaderKey(key)
+	if _, ok := knownProxyHeaders[key]; ok {
+		return true
+	}
+	for _, h := range batchForwardingHeaders {
+		if h == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Defines a ResponseWriter that writes to memory for batch sub-requests.
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(200)
+	return w.buf.Write(b)
+}
+
+// Turns the written response into a batch response.
+func (w *batchResponseWriter) response() BatchResponse {
+	headers := make(map[string][]string, len(w.header))
+	for k, v := range w.header {
+		if k == "Content-Length" {
+			continue
+		}
+		headers[k] = v
+	}
+
+	var body json.RawMessage
+	if w.buf.Len() > 0 {
+		if strings.HasPrefix(w.header.Get("Content-Type"), "application/json") {
+			body = w.buf.Bytes()
+		} else {
+			body, _ = json.Marshal(w.buf.String())
+		}
+	}
+
+	status := w.status
+	if status == 0 {
+		status = 200
+	}
+	return BatchResponse{Status: status, Headers: headers, Body: body}
+}
+
+// Batch is used to define a POST handler in the current route context that accepts a JSON array of sub-requests.
+// Each sub-request is dispatched through the router as a virtual request in order, and an array of the results is
+// returned. Sub-requests inherit the remote address, TLS state, cookies, and forwarding headers of the batch request
+// and default to JSON. Forwarding headers set on a sub-request are ignored. Batches can't be nested, and can have at
+// most the number of sub-requests set with SetMaxBatchSize.
+func Batch(c *Context) {
+	var reqs []BatchRequest
+	POST(c, func() ([]BatchResponse, error) {
+		if c.Value(batchRequestKey{}) != nil {
+			return nil, BadRequest{errors.New("batch requests can't be nested")}
+		}
+		max := c.r.maxBatchSize
+		if max == 0 {
+			max = defaultMaxBatchSize
+		}
+		if len(reqs) > max {
+			return nil, BadRequest{errors.New("too many sub-requests in the batch")}
+		}
+
+		subCtx := context.WithValue(c, batchRequestKey{}, true)
+		results := make([]BatchResponse, len(reqs))
+		for i, sub := range reqs {
+			method := sub.Method
+			if method == "" {
+				method = "GET"
+			}
+			req, err := http.NewRequestWithContext(subCtx, strings.ToUpper(method), sub.Path, bytes.NewReader(sub.Body))
+			if err != nil {
+				return nil, BadRequest{err}
+			}
+			req.RemoteAddr = c.req.RemoteAddr
+			req.Host = c.req.Host
+			req.TLS = c.req.TLS
+			if cookie := c.req.Header.Get("Cookie"); cookie != "" {
+				req.Header.Set("Cookie", cookie)
+			}
+			req.Header.Set("Accept", "application/json")
+			if len(sub.Body) > 0 {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			for k, v := range sub.Headers {
+				if !isIdentityHeader(k) {
+					req.Header.Set(k, v)
+				}
+			}
+			for k, v := range c.req.Header {
+				if isIdentityHeader(k) {
+					req.Header[k] = v
+				}
+			}
+
+			w := &batchResponseWriter{header: http.Header{}}
+			c.r.ServeHTTP(w, req)
+			results[i] = w.response()
+		}
+		return results, nil
+	}, &reqs)
+}
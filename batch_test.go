@@ -0,0 +1,150 @@
+package discobolt
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newBatchRouter() *Router {
+	r := &Router{}
+	Static(r, "admin", func(ctx *Context) {
+		AllowIPs(ctx, []string{"10.0.0.0/8"})
+		GET(ctx, func() (string, error) {
+			return "secret", nil
+		})
+	})
+	Static(r, "ip", func(ctx *Context) {
+		GET(ctx, func() (string, error) {
+			return ctx.RemoteIP().String(), nil
+		})
+	})
+	Static(r, "batch", func(ctx *Context) {
+		Batch(ctx)
+	})
+	return r
+}
+
+func doBatch(t *testing.T, r *Router, req *http.Request) (int, []BatchResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+	var results []BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatalf("failed to decode batch response: %v", err)
+	}
+	return w.Code, results
+}
+
+func newBatchRequest(body string) *http.Request {
+	req := httptest.NewRequest("POST", "/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	return req
+}
+
+func TestBatch_SpoofedProxyHeaders(t *testing.T) {
+	r := newBatchRouter()
+
+	// The request comes through Cloudflare from an IP outside the allowed range.
+	direct := httptest.NewRequest("GET", "/admin", nil)
+	direct.RemoteAddr = "173.245.48.1:1234"
+	direct.Header.Set("CF-Connecting-IP", "203.0.113.5")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, direct)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected direct request to be forbidden, got %d", w.Code)
+	}
+
+	req := newBatchRequest(`[
+		{"path": "/admin", "headers": {"CF-Connecting-IP": "10.1.2.3", "X-Forwarded-For": "10.1.2.3"}},
+		{"path": "/ip", "headers": {"cf-connecting-ip": "10.1.2.3"}}
+	]`)
+	req.RemoteAddr = "173.245.48.1:1234"
+	req.Header.Set("CF-Connecting-IP", "203.0.113.5")
+	code, results := doBatch(t, r, req)
+	if code != http.StatusOK {
+		t.Fatalf("expected batch to succeed, got %d", code)
+	}
+	if results[0].Status != http.StatusForbidden {
+		t.Errorf("expected spoofed sub-request to be forbidden, got %d: %s", results[0].Status, results[0].Body)
+	}
+	if string(results[1].Body) != `"203.0.113.5"` {
+		t.Errorf("expected sub-request to see the real client IP, got %s", results[1].Body)
+	}
+}
+
+func TestBatch_InheritsTLS(t *testing.T) {
+	r := newBatchRouter()
+	r.RequireHTTPS(true)
+
+	req := newBatchRequest(`[{"path": "/ip"}]`)
+	req.TLS = &tls.ConnectionState{}
+	code, results := doBatch(t, r, req)
+	if code != http.StatusOK {
+		t.Fatalf("expected batch to succeed, got %d", code)
+	}
+	if results[0].Status != http.StatusOK {
+		t.Errorf("expected sub-request over TLS to succeed, got %d", results[0].Status)
+	}
+}
+
+func TestBatch_MaxSize(t *testing.T) {
+	r := newBatchRouter()
+	r.SetMaxBatchSize(2)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"at limit", `[{"path": "/ip"}, {"path": "/ip"}]`, http.StatusOK},
+		{"over limit", `[{"path": "/ip"}, {"path": "/ip"}, {"path": "/ip"}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := doBatch(t, r, newBatchRequest(tt.body))
+			if code != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, code)
+			}
+		})
+	}
+}
+
+func TestBatch_Nested(t *testing.T) {
+	r := newBatchRouter()
+	code, results := doBatch(t, r, newBatchRequest(`[{"method": "POST", "path": "/batch", "body": [{"path": "/ip"}]}]`))
+	if code != http.StatusOK {
+		t.Fatalf("expected batch to succeed, got %d", code)
+	}
+	if results[0].Status != http.StatusBadRequest {
+		t.Errorf("expected nested batch to be rejected, got %d: %s", results[0].Status, results[0].Body)
+	}
+}
+
+func TestBatch_MultipleHeaderValues(t *testing.T) {
+	r := newBatchRouter()
+	Static(r, "login", func(ctx *Context) {
+		GET(ctx, func() (WithCookies, error) {
+			return WithCookies{
+				Cookies: []*http.Cookie{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}},
+				Body:    "ok",
+			}, nil
+		})
+	})
+
+	code, results := doBatch(t, r, newBatchRequest(`[{"path": "/login"}]`))
+	if code != http.StatusOK {
+		t.Fatalf("expected batch to succeed, got %d", code)
+	}
+	cookies := results[0].Headers["Set-Cookie"]
+	if len(cookies) != 2 || cookies[0] != "a=1" || cookies[1] != "b=2" {
+		t.Errorf("expected both cookies, got %v", cookies)
+	}
+}
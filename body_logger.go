@@ -0,0 +1,93 @@
+package discobolt
+
+import "net/http"
+
+// BodyLog is used to define the request and response bodies given to the development body logger. Bodies larger than
+// the size cap are cut off at it.
+type BodyLog struct {
+	// Status is the status code sent. This is 0 if nothing was sent (for example, a WebSocket took the connection).
+	Status int
+
+	// Request is the request body. This is only set if the body was read by the router. Streamed bodies are not kept.
+	Request          []byte
+	RequestTruncated bool
+
+	// Response is the response body before compression.
+	Response          []byte
+	ResponseTruncated bool
+}
+
+// SetDevBodyLogger is used to log the full request and response bodies of every request. This is meant for debugging
+// in development and should not be turned on in production, since bodies often contain credentials and personal data.
+// Bodies are cut off at maxSize bytes (1KB if this is 0 or less) so huge payloads don't flood the logs. Passing a nil
+// logger turns this off.
+func (r *Router) SetDevBodyLogger(maxSize int, logger func(*Context, BodyLog)) {
+	if maxSize <= 0 {
+		maxSize = 1024
+	}
+	r.devBodyLogger = logger
+	r.devBodyLogSize = maxSize
+}
+
+// Defines a response writer that records the status and the start of the body for the body logger.
+type recordingWriter struct {
+	http.ResponseWriter
+
+	max       int
+	status    int
+	body      []byte
+	truncated bool
+}
+
+// Unwrap returns the underlying response writer.
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if space := w.max - len(w.body); space > 0 {
+		if len(b) > space {
+			w.body = append(w.body, b[:space]...)
+			w.truncated = true
+		} else {
+			w.body = append(w.body, b...)
+		}
+	} else if len(b) > 0 {
+		w.truncated = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the underlying writer if it can be flushed.
+func (w *recordingWriter) Flush() {
+	if f, ok := writerWith[http.Flusher](w.ResponseWriter); ok {
+		f.(http.Flusher).Flush()
+	}
+}
+
+// Gives the bodies of the request to the logger. This is called once the response has been sent.
+func (r *Router) logBodies(c *Context, w *recordingWriter) {
+	entry := BodyLog{
+		Status:            w.status,
+		Response:          w.body,
+		ResponseTruncated: w.truncated,
+	}
+	if c.bodyRead {
+		entry.Request = c.body
+		if len(entry.Request) > w.max {
+			entry.Request = entry.Request[:w.max]
+			entry.RequestTruncated = true
+		}
+	}
+	r.devBodyLogger(c, entry)
+}
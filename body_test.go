@@ -0,0 +1,81 @@
+package discobolt
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRawBody_Limit(t *testing.T) {
+	r := &Router{}
+	r.SetMaxBodySize(10)
+	Static(r, "upload", func(ctx *Context) {
+		var buf bytes.Buffer
+		POST(ctx, func() (int, error) {
+			return buf.Len(), nil
+		}, &buf)
+	})
+
+	tests := []struct {
+		name    string
+		size    int
+		chunked bool
+		status  int
+	}{
+		{"at limit", 10, false, http.StatusOK},
+		{"over limit", 50, false, http.StatusRequestEntityTooLarge},
+		{"chunked at limit", 10, true, http.StatusOK},
+		{"chunked over limit", 50, true, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(strings.Repeat("a", tt.size))
+			if tt.chunked {
+				// Hide the length so the request has no Content-Length.
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest("POST", "/upload", body)
+			req.Header.Set("Content-Type", "application/octet-stream")
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRawBody_FromCheck(t *testing.T) {
+	r := &Router{}
+	r.SetMaxBodySize(10)
+	var seen []byte
+	Static(r, "upload", func(ctx *Context) {
+		AddCheckCtx(ctx, func(ctx *Context) error {
+			b, err := ctx.RawBody()
+			seen = b
+			return err
+		})
+		var buf bytes.Buffer
+		POST(ctx, func() (string, error) {
+			return buf.String(), nil
+		}, &buf)
+	})
+
+	req := httptest.NewRequest("POST", "/upload", io.MultiReader(strings.NewReader(strings.Repeat("a", 50))))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d: %s", w.Code, w.Body.String())
+	}
+	if seen != nil {
+		t.Errorf("expected no body for the check, got %d bytes", len(seen))
+	}
+}
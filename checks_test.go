@@ -0,0 +1,207 @@
+package discobolt
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Records how much of a streamed body was read.
+type streamInput struct {
+	n int64
+}
+
+func (s *streamInput) DecodeStream(r io.Reader) error {
+	var err error
+	s.n, err = io.Copy(io.Discard, r)
+	return err
+}
+
+func TestChecks_RunBeforeBodyIsRead(t *testing.T) {
+	denied := HTTPError{Code: http.StatusUnauthorized, Message: "denied"}
+	tests := []struct {
+		name        string
+		global      bool
+		addCheck    func(ctx *Context)
+		contentType string
+		stream      bool
+	}{
+		{name: "global check", global: true, contentType: "application/json"},
+		{name: "route check", addCheck: func(ctx *Context) {
+			AddCheck(ctx, func() error { return denied })
+		}, contentType: "application/json"},
+		{name: "context check", addCheck: func(ctx *Context) {
+			AddCheckCtx(ctx, func(*Context) error { return denied })
+		}, contentType: "application/json"},
+		{name: "multipart form", addCheck: func(ctx *Context) {
+			AddCheck(ctx, func() error { return denied })
+		}, contentType: "multipart/form-data; boundary=x"},
+		{name: "streamed body", addCheck: func(ctx *Context) {
+			AddCheck(ctx, func() error { return denied })
+		}, contentType: "application/octet-stream", stream: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Router{}
+			if tt.global {
+				r.AddGlobalCheck(func() error { return denied })
+			}
+			handlerRan := false
+			Static(r, "upload", func(ctx *Context) {
+				if tt.addCheck != nil {
+					tt.addCheck(ctx)
+				}
+				handler := func() (string, error) {
+					handlerRan = true
+					return "", nil
+				}
+				if tt.stream {
+					POST(ctx, handler, &streamInput{})
+				} else {
+					var in struct {
+						Name string `json:"name" form:"name"`
+					}
+					POST(ctx, handler, &in)
+				}
+			})
+
+			body := &countingBody{r: strings.NewReader(`{"name": "hello"}`)}
+			req := httptest.NewRequest("POST", "/upload", body)
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("expected 401, got %d: %s", w.Code, w.Body.String())
+			}
+			if body.read != 0 {
+				t.Errorf("expected the body to be untouched, but %d bytes were read", body.read)
+			}
+			if handlerRan {
+				t.Error("expected the handler not to run")
+			}
+		})
+	}
+}
+
+func TestChecks_RunOncePerRequest(t *testing.T) {
+	var rootCount, routeCount, ctxCount int
+	r := &Router{}
+	Static(r, "items", func(ctx *Context) {
+		AddCheck(ctx, func() error {
+			rootCount++
+			return nil
+		})
+		GET(ctx, func() (string, error) {
+			return "list", nil
+		})
+		var in struct {
+			Name string `json:"name"`
+		}
+		POST(ctx, func() (string, error) {
+			return in.Name, nil
+		}, &in)
+		String(ctx, func(ctx *Context, id string) {
+			AddCheck(ctx, func() error {
+				routeCount++
+				return nil
+			})
+			AddCheckCtx(ctx, func(*Context) error {
+				ctxCount++
+				return nil
+			})
+			GET(ctx, func() (string, error) {
+				return id, nil
+			})
+			DELETE(ctx, func() (string, error) {
+				return id, nil
+			})
+		})
+	})
+
+	tests := []struct {
+		method    string
+		path      string
+		body      string
+		rootRuns  int
+		routeRuns int
+	}{
+		{"GET", "/items", "", 1, 0},
+		{"POST", "/items", `{"name": "a"}`, 1, 0},
+		{"GET", "/items/1", "", 1, 1},
+		{"DELETE", "/items/1", "", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rootCount, routeCount, ctxCount = 0, 0, 0
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if rootCount != tt.rootRuns || routeCount != tt.routeRuns || ctxCount != tt.routeRuns {
+				t.Errorf("expected checks to run %d and %d times, got %d, %d, and %d",
+					tt.rootRuns, tt.routeRuns, rootCount, routeCount, ctxCount)
+			}
+		})
+	}
+}
+
+func TestChecks_Redirect(t *testing.T) {
+	redirect := Redirect{URL: "/login", StatusCode: http.StatusSeeOther}
+	tests := []struct {
+		name     string
+		addCheck func(ctx *Context)
+	}{
+		{"AddCheck", func(ctx *Context) {
+			AddCheck(ctx, func() error { return redirect })
+		}},
+		{"AddCheckCtx", func(ctx *Context) {
+			AddCheckCtx(ctx, func(*Context) error { return &redirect })
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var routeCtx *Context
+			handlerRan := false
+			r := &Router{}
+			Static(r, "account", func(ctx *Context) {
+				routeCtx = ctx
+				tt.addCheck(ctx)
+				var in struct {
+					Name string `json:"name"`
+				}
+				POST(ctx, func() (string, error) {
+					handlerRan = true
+					return in.Name, nil
+				}, &in)
+			})
+
+			body := &countingBody{r: strings.NewReader(`{"name": "hello"}`)}
+			req := httptest.NewRequest("POST", "/account", body)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusSeeOther {
+				t.Errorf("expected 303, got %d: %s", w.Code, w.Body.String())
+			}
+			if loc := w.Header().Get("Location"); loc != "/login" {
+				t.Errorf("expected Location /login, got %q", loc)
+			}
+			if routeCtx == nil || !routeCtx.consumed {
+				t.Error("expected the context to be consumed")
+			}
+			if handlerRan {
+				t.Error("expected the handler not to run")
+			}
+			if body.read != 0 {
+				t.Errorf("expected the body not to be decoded, but %d bytes were read", body.read)
+			}
+		})
+	}
+}
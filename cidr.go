@@ -0,0 +1,88 @@
+package discobolt
+
+import (
+	"net"
+	"strings"
+)
+
+// Defines a node in a CIDR trie. Each level down the trie is one more bit of the address.
+type cidrNode struct {
+	children [2]*cidrNode
+	value    string
+	set      bool
+}
+
+// Defines a table of CIDR ranges split by IP version. Each range has a value (such as the header a proxy uses). The
+// ranges are kept in a binary trie so that looking up an IP takes at most one step per bit of the address, however
+// many ranges there are.
+type cidrTable struct {
+	v4 cidrNode
+	v6 cidrNode
+}
+
+// Parses a CIDR range. A single IP is treated as a range containing just that IP.
+func parseCIDR(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		if ip := net.ParseIP(s); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+			}
+			return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	return ipNet, err
+}
+
+// Gets the root node and the address bytes for the IP.
+func (t *cidrTable) root(x net.IP) (*cidrNode, net.IP) {
+	if ip4 := x.To4(); ip4 != nil {
+		return &t.v4, ip4
+	}
+	return &t.v6, x.To16()
+}
+
+// Gets the bit of the address at the index.
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+// Adds a range to the table. If the range is already in the table, the first value is kept.
+func (t *cidrTable) add(ipNet *net.IPNet, value string) {
+	node, ip := &t.v6, ipNet.IP.To16()
+	if len(ipNet.Mask) == net.IPv4len {
+		node, ip = &t.v4, ipNet.IP.To4()
+	}
+	ones, _ := ipNet.Mask.Size()
+	for i := 0; i < ones; i++ {
+		b := ipBit(ip, i)
+		if node.children[b] == nil {
+			node.children[b] = &cidrNode{}
+		}
+		node = node.children[b]
+	}
+	if !node.set {
+		node.value = value
+		node.set = true
+	}
+}
+
+// Finds the value of the most specific range containing the IP.
+func (t *cidrTable) lookup(x net.IP) (string, bool) {
+	node, ip := t.root(x)
+	if ip == nil {
+		return "", false
+	}
+	value, found := node.value, node.set
+	for i := 0; i < len(ip)*8; i++ {
+		node = node.children[ipBit(ip, i)]
+		if node == nil {
+			break
+		}
+		if node.set {
+			value, found = node.value, true
+		}
+	}
+	return value, found
+}
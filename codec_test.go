@@ -0,0 +1,53 @@
+package discobolt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Panics when it is marshalled. A cyclic value would make yaml.v3 overflow the stack, which can't be recovered from.
+type panickingValue struct{}
+
+func (panickingValue) MarshalYAML() (any, error) {
+	panic("yaml marshal failed")
+}
+
+func (panickingValue) MarshalJSON() ([]byte, error) {
+	panic("json marshal failed")
+}
+
+func TestCodecPanic(t *testing.T) {
+	tests := []struct {
+		accept string
+		value  string
+	}{
+		{"application/yaml", "yaml marshal failed"},
+		{"application/json", "json marshal failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			var logged []PanicError
+			r := &Router{}
+			r.SetPanicLogger(func(_ *Context, err PanicError) {
+				logged = append(logged, err)
+			})
+			Static(r, "bad", func(ctx *Context) {
+				GET(ctx, func() (panickingValue, error) {
+					return panickingValue{}, nil
+				})
+			})
+
+			req := httptest.NewRequest("GET", "/bad", nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("expected 500, got %d: %s", w.Code, w.Body.String())
+			}
+			if len(logged) != 1 || logged[0].Value != tt.value {
+				t.Errorf("expected the panic to be logged once, got %v", logged)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package discobolt
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// Defines the content types that are not compressed by default. These are already compressed, so compressing them
+// again wastes CPU for little or no gain.
+var defaultCompressionSkipTypes = []string{
+	"image/*",
+	"video/*",
+	"audio/*",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/pdf",
+}
+
+// EnableCompression is used to gzip responses for clients that send "gzip" in the Accept-Encoding header. Responses
+// with a content type in the skip list (see SetCompressionSkipTypes), without a content type, or that already have a
+// Content-Encoding are sent as is. This is off by default.
+func (r *Router) EnableCompression(enabled bool) {
+	r.compression = enabled
+}
+
+// SetCompressionSkipTypes is used to replace the content types that are never compressed. Types can end in "/*" to
+// match everything of that type (such as "image/*"). By default, images, video, audio, web fonts, and common archive
+// and PDF types are skipped since they are already compressed.
+func (r *Router) SetCompressionSkipTypes(types ...string) {
+	r.compressionSkipTypes = types
+}
+
+// Checks if responses of the content type should be compressed.
+func (r *Router) compressible(contentType string) bool {
+	if contentType == "" {
+		// We can't tell what this is, and net/http would sniff the compressed bytes.
+		return false
+	}
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	skip := r.compressionSkipTypes
+	if skip == nil {
+		skip = defaultCompressionSkipTypes
+	}
+	for _, t := range skip {
+		t = strings.ToLower(t)
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if the client accepts gzip responses.
+func acceptsGzip(req *http.Request) bool {
+	for _, part := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range params[1:] {
+			param = strings.ReplaceAll(param, " ", "")
+			if strings.HasPrefix(param, "q=0") && strings.Trim(param[3:], ".0") == "" {
+				accepted = false
+			}
+		}
+		if accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// Defines a response writer that gzips the body if the content type benefits from it. The decision is made when the
+// header is written, since that is when the content type is known.
+type compressWriter struct {
+	http.ResponseWriter
+
+	r           *Router
+	acceptsGzip bool
+	decided     bool
+	gz          *gzip.Writer
+}
+
+// Unwrap returns the underlying response writer.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if !w.decided {
+		w.decided = true
+		h := w.Header()
+		if status != http.StatusNoContent && status != http.StatusNotModified &&
+			status != http.StatusPartialContent && h.Get("Content-Encoding") == "" &&
+			w.r.compressible(h.Get("Content-Type")) {
+			// Caches need to know this response depends on Accept-Encoding, even if this client didn't get gzip.
+			addVary(h, "Accept-Encoding")
+			if w.acceptsGzip {
+				h.Set("Content-Encoding", "gzip")
+				h.Del("Content-Length")
+				w.gz = gzip.NewWriter(w.ResponseWriter)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the compressed data written so far and then the underlying writer (if it can be flushed).
+func (w *compressWriter) Flush() {
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	if f, ok := writerWith[http.Flusher](w.ResponseWriter); ok {
+		f.(http.Flusher).Flush()
+	}
+}
+
+// Finishes the compressed body. This is called once the request is done.
+func (w *compressWriter) close() {
+	if w.gz != nil {
+		_ = w.gz.Close()
+	}
+}
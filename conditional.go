@@ -0,0 +1,115 @@
+package discobolt
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Parses a list of entity tags as used by If-Match and If-None-Match. Commas are allowed inside of quoted tags, so
+// this can't just split on commas. Each tag is returned as it was sent (including the W/ prefix and quotes).
+func parseETagList(header string) []string {
+	var tags []string
+	for {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			return tags
+		}
+
+		// Handle the wildcard.
+		if header[0] == '*' {
+			tags = append(tags, "*")
+			header = header[1:]
+			continue
+		}
+
+		// Find the end of the tag.
+		start := 0
+		if strings.HasPrefix(header, "W/") {
+			start = 2
+		}
+		if len(header) <= start || header[start] != '"' {
+			// Not a valid tag. Skip until the next comma.
+			i := strings.IndexByte(header, ',')
+			if i == -1 {
+				return tags
+			}
+			header = header[i:]
+			continue
+		}
+		end := strings.IndexByte(header[start+1:], '"')
+		if end == -1 {
+			return tags
+		}
+		end += start + 2
+		tags = append(tags, header[:end])
+		header = header[end:]
+	}
+}
+
+// IfMatch returns the entity tags in the If-Match header. This is used for optimistic concurrency on updates. If the
+// current entity tag of the resource doesn't match using StrongETagMatch, the handler should return
+// PreconditionFailed. A nil slice means the header was not sent.
+func (c *Context) IfMatch() []string {
+	return parseETagList(c.req.Header.Get("If-Match"))
+}
+
+// IfNoneMatch returns the entity tags in the If-None-Match header. If the current entity tag of the resource matches
+// using WeakETagMatch, the handler should return NotModified. A nil slice means the header was not sent.
+func (c *Context) IfNoneMatch() []string {
+	return parseETagList(c.req.Header.Get("If-None-Match"))
+}
+
+// IfUnmodifiedSince returns the time in the If-Unmodified-Since header. This is used for safe updates and deletes when
+// the resource has a modification time rather than an entity tag. If the resource was modified after this time, the
+// handler should return PreconditionFailed. HTTP dates only have second precision, so truncate the modification time
+// to the second before comparing. The boolean is false if the header was not sent or is not a valid HTTP date.
+func (c *Context) IfUnmodifiedSince() (time.Time, bool) {
+	header := c.req.Header.Get("If-Unmodified-Since")
+	if header == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// WeakETagMatch reports whether the entity tag matches any of the tags using the weak comparison from RFC 7232, which
+// ignores the W/ prefix. This is the comparison to use for If-None-Match since CDNs often rewrite tags as weak. "*"
+// matches anything.
+func WeakETagMatch(tags []string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range tags {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// StrongETagMatch reports whether the entity tag matches any of the tags using the strong comparison from RFC 7232,
+// where both tags must be strong and identical. This is the comparison to use for If-Match. "*" matches anything.
+func StrongETagMatch(tags []string, etag string) bool {
+	if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, tag := range tags {
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// NotModified returns a HTTPError with the status 304. This is sent without a body.
+func NotModified() HTTPError {
+	return HTTPError{Code: http.StatusNotModified}
+}
+
+// PreconditionFailed returns a HTTPError with the status 412. This is used when a conditional request header such as
+// If-Match does not match the current state of the resource.
+func PreconditionFailed(message any) HTTPError {
+	return HTTPError{Code: http.StatusPreconditionFailed, Message: message}
+}
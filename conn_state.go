@@ -0,0 +1,42 @@
+package discobolt
+
+import (
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// ConnState is used to track connection reuse. To use it, set it as the ConnState hook on the server
+// (server.ConnState = router.ConnState). If the server has its own hook, call this from it. Connections are keyed by
+// their remote address and forgotten once they are closed or hijacked.
+func (r *Router) ConnState(conn net.Conn, state http.ConnState) {
+	addr := conn.RemoteAddr().String()
+	switch state {
+	case http.StateNew:
+		r.conns.Store(addr, new(int64))
+	case http.StateActive:
+		if count, ok := r.conns.Load(addr); ok {
+			atomic.AddInt64(count.(*int64), 1)
+		}
+	case http.StateClosed, http.StateHijacked:
+		r.conns.Delete(addr)
+	}
+}
+
+// ConnectionRequests returns the number of requests that have been made on the connection this request came in on,
+// including this one. This returns 0 if the router's ConnState hook is not set on the server. For HTTP/2, the count
+// only goes up when the connection goes from idle to active, so concurrent streams are not counted.
+func (c *Context) ConnectionRequests() int {
+	count, ok := c.r.conns.Load(c.req.RemoteAddr)
+	if !ok {
+		return 0
+	}
+	return int(atomic.LoadInt64(count.(*int64)))
+}
+
+// ConnectionReused returns true if this request came in on a connection that already served a request. This is useful
+// for diagnosing connection churn under load. This is always false if the router's ConnState hook is not set on the
+// server.
+func (c *Context) ConnectionReused() bool {
+	return c.ConnectionRequests() > 1
+}
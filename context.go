@@ -10,17 +10,22 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"reflect"
+	"regexp"
+	"runtime/debug"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/schema"
 	"github.com/gorilla/websocket"
-	"github.com/vmihailenco/msgpack"
 	"gopkg.in/yaml.v3"
 )
 
@@ -31,26 +36,103 @@ type contextBase struct {
 	w   http.ResponseWriter
 	r   *Router
 
+	start    time.Time
+	status   int
+	trailers bool
 	consumed bool
+
+	// matchedMethods is the Allow header value for the last route that matched the whole path but not the method.
+	matchedMethods string
+
+	// dryRun is set when the context is being used by Match. Methods are recorded here rather than run.
+	dryRun *routeMatch
+
+	// Defines the buffered request body. This is filled the first time RawBody is called.
+	body     []byte
+	bodyErr  error
+	bodyRead bool
+
+	// values is the per-request store written by WithValue. This is shared by every context in the request.
+	values     map[any]any
+	valuesLock sync.RWMutex
+}
+
+// WithValue sets a value in the per-request store, which is shared by every route context in the request. Unlike
+// context.WithValue, this changes the current context rather than making a new one, so a check can resolve something
+// (such as the authenticated user) for the handler to read with Value. The key should be of an unexported type to
+// avoid collisions, in the same way as context.WithValue.
+func (c *Context) WithValue(key, val any) {
+	c.valuesLock.Lock()
+	if c.values == nil {
+		c.values = map[any]any{}
+	}
+	c.values[key] = val
+	c.valuesLock.Unlock()
 }
 
+// Value returns the value for the key from the per-request store, falling back to the request context. This implements
+// context.Context, so values set with WithValue are visible to anything the context is passed to.
+func (c *Context) Value(key any) any {
+	c.valuesLock.RLock()
+	val, ok := c.values[key]
+	c.valuesLock.RUnlock()
+	if ok {
+		return val
+	}
+	return c.Context.Value(key)
+}
+
+// ResponseTransformer is used to transform the body of a successful response before it is sent. For example, this can
+// be used to wrap every response in an envelope.
+type ResponseTransformer func(c *Context, body any) any
+
 // Check is used to check if the current route passes a check. If error is not nil, execution will be aborted and
-// the error will be returned to the user.
+// the error will be returned to the user. A Redirect can be returned to send the client elsewhere instead (for
+// example, to a login page).
 type Check func() error
 
-// Context is used to define the HTTP context.
+// Context is used to define the HTTP context. It is also a context.Context for the request, so it can be passed to
+// outbound HTTP and database calls. It is cancelled when the client goes away, and Deadline reports the deadline of the
+// request (if any), so contexts derived from it get the remaining time.
 type Context struct {
 	*contextBase
 
-	// Defines the values needed for websocket handling. It kinda sucks that we need to save GET until the end,
-	// but it does mean that we can manage this better.
+	// Defines the values needed for websocket handling.
 	webSocketUpgrader *websocket.Upgrader
 	webSocketHandler  func(*websocket.Conn) error
-	getRunner         func()
+	webSocketStats    func(*Context, WebSocketStats)
+	webSocketIdle     time.Duration
+
+	// methods maps the HTTP methods registered on this context to their runners. These run once the matcher function
+	// returns, so everything on the context (checks, WebSockets) is registered by the time they run.
+	methods map[string]func()
 
 	pathRemainder []byte
 	handlers      []handler
 	checks        []Check
+
+	// transformers are applied to successful results before they are sent. They are inherited by child routes.
+	transformers []ResponseTransformer
+
+	// tags are the tags added with WithTags. They are inherited by child routes.
+	tags []string
+
+	// rawInput is set by RawInput to skip decoding request bodies on this route.
+	rawInput bool
+
+	// cors is used to define the CORS policy. This is inherited by child routes.
+	cors *CORSOptions
+
+	// allowedResponseCodecs restricts the content types responses can be negotiated as. Nil means everything the router
+	// has enabled. This is inherited by child routes.
+	allowedResponseCodecs map[string]struct{}
+
+	// trace is used to define the route taken to get to this context. This is only set during a dry run.
+	trace *routeMatch
+
+	// checksRan is the number of checks that have already passed. Checks can be run from both the method handlers and
+	// afterExecute, so this stops side effects (like rate limiting) happening twice.
+	checksRan int
 }
 
 // Cookies returns the cookies.
@@ -94,6 +176,74 @@ func (c *Context) GetAuthenticityToken() string {
 // CSRFValidator is a special input that checks the authenticity token.
 type CSRFValidator struct{}
 
+// StreamDecoder is an input that decodes the request body incrementally (for example, a stream of NDJSON records)
+// rather than having it read into memory first. The reader is limited to the maximum body size of the router, and
+// returns RequestEntityTooLarge if the body goes over it. This is not used for GET requests.
+type StreamDecoder interface {
+	DecodeStream(r io.Reader) error
+}
+
+// Defines an input that is decoded from the query string. This is made with QueryInput.
+type queryInput struct {
+	v any
+}
+
+// QueryInput wraps an input so that it is always decoded from the query string (using "query" tags), whatever the
+// method. This lets a POST take its body in one input and things like pagination from the query string in another.
+// The input is validated if it implements Validator.
+func QueryInput(v any) any {
+	return queryInput{v: v}
+}
+
+// BindQuery decodes the query string into v (using "query" tags) and validates it if it implements Validator. This can
+// be used anywhere a context is available, such as a check added with AddCheckCtx. Decoding errors and queries with
+// more parameters than the router allows are returned as a BadRequest.
+func (c *Context) BindQuery(v any) error {
+	if c.tooManyParams("", nil) {
+		return BadRequest{errors.New("too many query parameters")}
+	}
+	if err := c.decodeQuery(v, c.req.URL.Query()); err != nil {
+		return BadRequest{err}
+	}
+	if val, ok := v.(Validator); ok {
+		return validateInput(val)
+	}
+	return nil
+}
+
+// Checks if any of the inputs decode the body as a stream.
+func hasStreamDecoder(inputs []any) bool {
+	for _, v := range inputs {
+		if _, ok := v.(StreamDecoder); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Defines a reader that returns RequestEntityTooLarge if there is more than n bytes.
+type limitedBody struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// Check if there is anything else before saying it's too large.
+		var b [1]byte
+		if n, _ := l.r.Read(b[:]); n > 0 {
+			return 0, RequestEntityTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
 // RequestHeaders returns the request headers.
 func (c *Context) RequestHeaders() http.Header {
 	return c.req.Header
@@ -104,11 +254,118 @@ func (c *Context) ResponseHeaders() http.Header {
 	return c.w.Header()
 }
 
+// WriteRaw writes the body as is with the status and content type given, skipping content negotiation. This is useful
+// for error handlers that need full control over the response. Nothing is written if the response was already sent.
+func (c *Context) WriteRaw(status int, contentType string, body []byte) {
+	if c.consumed {
+		return
+	}
+	c.consumed = true
+	if contentType != "" {
+		c.w.Header().Set("Content-Type", contentType)
+	}
+	if !c.trailers {
+		c.w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	c.w.WriteHeader(status)
+	_, _ = c.w.Write(body)
+}
+
+// IsXHR returns true if the request was made with XMLHttpRequest (the X-Requested-With header is set to
+// XMLHttpRequest). Most JavaScript libraries set this, but fetch does not.
+func (c *Context) IsXHR() bool {
+	return strings.EqualFold(c.req.Header.Get("X-Requested-With"), "XMLHttpRequest")
+}
+
+// ProtoMajor returns the major HTTP version of the request (1 for HTTP/1.x, 2 for HTTP/2).
+func (c *Context) ProtoMajor() int {
+	return c.req.ProtoMajor
+}
+
+// IsHTTP2 returns true if the request was made over HTTP/2.
+func (c *Context) IsHTTP2() bool {
+	return c.req.ProtoMajor == 2
+}
+
+// Push starts a HTTP/2 server push for the target. Returns PushNotSupported if the request is not HTTP/2 or the server
+// can't push (for example, the client turned it off).
+func (c *Context) Push(target string, opts *http.PushOptions) error {
+	w, ok := writerWith[http.Pusher](c.w)
+	if !ok || !c.IsHTTP2() {
+		return PushNotSupported
+	}
+	if err := w.(http.Pusher).Push(target, opts); err != nil {
+		if errors.Is(err, http.ErrNotSupported) {
+			return PushNotSupported
+		}
+		return err
+	}
+	return nil
+}
+
+// SetTrailer sets a trailer to be sent after the body (for example, a final status after a stream). Trailers set before
+// the response is written are declared in the Trailer header, and the response is sent without a Content-Length so
+// that it is chunked. Trailers can also be set whilst streaming. Returns TrailersNotSupported on HTTP/1.0.
+func (c *Context) SetTrailer(key, value string) error {
+	if !c.req.ProtoAtLeast(1, 1) {
+		return TrailersNotSupported
+	}
+	if !c.consumed {
+		c.w.Header().Add("Trailer", http.CanonicalHeaderKey(key))
+		c.trailers = true
+	}
+	c.w.Header().Set(http.TrailerPrefix+key, value)
+	return nil
+}
+
+// Attachment sets the Content-Disposition header so that the browser downloads the response with the filename given.
+// Non-ASCII filenames are encoded as per RFC 5987. This must be called before the body is written.
+func (c *Context) Attachment(filename string) {
+	c.setContentDisposition("attachment", filename)
+}
+
+// Inline sets the Content-Disposition header so that the browser displays the response, using the filename given if
+// the user saves it. This must be called before the body is written.
+func (c *Context) Inline(filename string) {
+	c.setContentDisposition("inline", filename)
+}
+
+func (c *Context) setContentDisposition(disposition, filename string) {
+	v := mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+	if v == "" {
+		// The filename could not be encoded. Still set the disposition.
+		v = disposition
+	}
+	c.w.Header().Set("Content-Disposition", v)
+}
+
 // URL returns the URL of the request.
 func (c *Context) URL() *url.URL {
 	return c.req.URL
 }
 
+// StartTime returns when the router started handling the request.
+func (c *Context) StartTime() time.Time {
+	return c.start
+}
+
+// Elapsed returns how long it has been since the router started handling the request.
+func (c *Context) Elapsed() time.Duration {
+	return time.Since(c.start)
+}
+
+// SetStatus sets the status code to send when the handler returns successfully (for example, 202 Accepted for async
+// work or 206 Partial Content). The result is still sent as the body. A nil result is sent as null rather than 204 No
+// Content. This has no effect on errors or redirects.
+func (c *Context) SetStatus(code int) {
+	c.status = code
+}
+
+// PathRemainder returns the part of the path that has not been consumed by matchers yet.
+func (c *Context) PathRemainder() string {
+	return string(c.pathRemainder)
+}
+
 // RemoteIP returns the remote IP address. If the request is behind a known proxy IP, it will try to get the real IP.
 // Supported proxies are currently Cloudflare and Fastly.
 func (c *Context) RemoteIP() net.IP {
@@ -117,23 +374,109 @@ func (c *Context) RemoteIP() net.IP {
 		return nil
 	}
 	ip := net.ParseIP(ipS)
-	if !c.r.disableAutoProxy {
-		header := evalIp(ip)
-		if header != "" {
-			h := c.req.Header.Get(header)
-			if h != "" {
-				return net.ParseIP(h)
-			}
+	if header := c.trustedProxyHeader(ip); header != "" {
+		h := c.req.Header.Get(header)
+		if h != "" {
+			return net.ParseIP(h)
 		}
 	}
 	return ip
 }
 
+// Returns the header a trusted proxy uses for the real IP if the peer IP is a known proxy, or a blank string if it
+// isn't (or auto proxy is disabled).
+func (c *Context) trustedProxyHeader(peerIP net.IP) string {
+	if c.r.disableAutoProxy || peerIP == nil {
+		return ""
+	}
+	return evalIp(peerIP)
+}
+
+// Checks if the request was made over HTTPS. X-Forwarded-Proto is only trusted if the peer is a known proxy.
+func (c *Context) isHTTPS() bool {
+	if c.req.TLS != nil {
+		return true
+	}
+	ipS, _, err := net.SplitHostPort(c.req.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	if c.trustedProxyHeader(net.ParseIP(ipS)) == "" {
+		return false
+	}
+	return strings.EqualFold(c.req.Header.Get("X-Forwarded-Proto"), "https")
+}
+
 // AddCheck adds a check to the context.
 func AddCheck(ctx *Context, check Check) {
 	ctx.checks = append(ctx.checks, check)
 }
 
+// Checks returns a copy of the checks registered on the context in the order they run. This is useful for debugging
+// a check that is unexpectedly blocking a route.
+func (c *Context) Checks() []Check {
+	checks := make([]Check, len(c.checks))
+	copy(checks, c.checks)
+	return checks
+}
+
+// AddResponseTransformer adds a response transformer to the context. It applies to methods on this context and any
+// child routes. Transformers on child routes run before the ones on their parents, so the outermost route gets the
+// final say (for example, an envelope added at the top of an API wraps everything else).
+func AddResponseTransformer(ctx *Context, t ResponseTransformer) {
+	ctx.transformers = append(ctx.transformers, t)
+}
+
+// WithTags adds tags (such as "public" or "admin") to the context and its child routes. Checks and handlers can read
+// them with RouteTags to make policy decisions without matching on the path. Since the checks of a route run before
+// its child routes are matched, a check only sees the tags of its own context and the ones above it.
+func WithTags(ctx *Context, tags ...string) {
+	ctx.tags = append(ctx.tags, tags...)
+}
+
+// RouteTags returns a copy of the tags added to this route and the routes above it, outermost first.
+func (c *Context) RouteTags() []string {
+	tags := make([]string, len(c.tags))
+	copy(tags, c.tags)
+	return tags
+}
+
+// RawInput marks the route so that request bodies are never decoded, whatever their content type. Inputs must
+// implement io.Writer (such as a *bytes.Buffer) or StreamDecoder and are given the body as is, or use QueryInput for
+// the query string. This is an escape hatch for custom wire formats. It only applies to this context, not its child
+// routes.
+func RawInput(ctx *Context) {
+	ctx.rawInput = true
+}
+
+// AllowResponseTypes restricts the content types responses from this context and its child routes can be sent as (for
+// example, just "application/json" for an endpoint returning sensitive data). Aliases of the content types are allowed
+// too. Calling this again on a child route replaces the set for that subtree. Content types disabled on the router
+// stay disabled. Clients that only accept other content types get 406 Not Acceptable.
+func AllowResponseTypes(ctx *Context, types ...string) {
+	ctx.allowedResponseCodecs = codecSet(types)
+}
+
+// AddCheckForMethods adds a check to the context that only runs when the request method is one of the methods
+// specified. This is useful for checks that only make sense for write methods such as POST, PUT, and DELETE.
+func AddCheckForMethods(ctx *Context, methods []string, check Check) {
+	AddCheck(ctx, func() error {
+		for _, method := range methods {
+			if method == ctx.req.Method {
+				return check()
+			}
+		}
+		return nil
+	})
+}
+
+// AddCheckCtx adds a check that is given the context of the request. This can be used on the router or a route group
+// as well as a context, so reusable checks (such as authentication) don't need the context passed in when they are
+// made. The check can use WithValue to pass what it resolved to the handler.
+func AddCheckCtx(c RouterOrContext, check func(*Context) error) {
+	c.addContextCheck(check)
+}
+
 func (c *Context) addHandler(h handler) {
 	if c.consumed {
 		return
@@ -142,24 +485,70 @@ func (c *Context) addHandler(h handler) {
 	sort.Sort(routesSorter{a: c.handlers})
 }
 
-// IsBadRequest returns true if the error is a bad request error.
+// Adds a check that needs the context.
+func (c *Context) addContextCheck(check func(*Context) error) {
+	AddCheck(c, func() error {
+		return check(c)
+	})
+}
+
+// IsBadRequest returns true if the error is a bad request error. Both BadRequest and *BadRequest are detected at any
+// depth of wrapping.
 func IsBadRequest(err error) bool {
-	var badReqErr *BadRequest
-	nextErr := err
-	for nextErr != nil {
-		if br, ok := nextErr.(BadRequest); ok {
-			badReqErr = &br
-			break
-		}
-		nextErr = errors.Unwrap(nextErr)
+	var br BadRequest
+	if errors.As(err, &br) {
+		return true
+	}
+	var brPtr *BadRequest
+	return errors.As(err, &brPtr)
+}
+
+// Checks if the redirect target stays on the host of the request. The target is resolved against the request the way a
+// browser would, so targets like "//evil.com", "/\evil.com", and "http:evil.com" are caught.
+func sameHostTarget(req *http.Request, target string) bool {
+	// Browsers ignore leading and trailing spaces and control characters, and treat backslashes like forward slashes.
+	target = strings.TrimFunc(strings.ReplaceAll(target, "\\", "/"), func(r rune) bool {
+		return r <= ' '
+	})
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
 	}
-	return badReqErr != nil
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https":
+	default:
+		return false
+	}
+	if u.Host == "" && (u.Scheme != "" || u.Opaque != "" || strings.HasPrefix(u.Path, "//")) {
+		// Browsers take "http:/evil.com", "http:evil.com", and "///evil.com" as being on another host.
+		return false
+	}
+	base := &url.URL{Scheme: "http", Host: req.Host, Path: req.URL.Path}
+	return strings.EqualFold(base.ResolveReference(u).Host, req.Host)
 }
 
 // Redirect is a special type that when detected will lead to a redirect.
 type Redirect struct {
 	URL       string
 	Permanent bool
+
+	// SameHostOnly is used to make sure the redirect stays on the current host. If the URL points to another host (or
+	// a non-HTTP scheme), the OffSiteRedirect error is returned instead. Use this when the URL comes from user input
+	// to prevent open redirects.
+	SameHostOnly bool
+
+	// StatusCode is used to set the redirect status code explicitly (for example, 301, 302, or 303). If this is 0,
+	// 308 is used if Permanent is true and 307 otherwise.
+	StatusCode int
+
+	// Flash is used to set a one-time message for the next request to read with Flash (for example, "Post created").
+	// This is kept in a signed cookie, so the router needs a cookie secret.
+	Flash string
+}
+
+// SeeOther returns a redirect with the status 303. This is generally what you want after a POST.
+func SeeOther(url string) Redirect {
+	return Redirect{URL: url, StatusCode: http.StatusSeeOther}
 }
 
 // Error implements the error interface. This allows you to throw a redirect as a error and have it magically handled.
@@ -171,291 +560,1010 @@ func (r Redirect) Body() any { return r }
 // Status returns nothing and is just here to implement UserFacingError. This allows you to throw a redirect as a error and have it magically handled.
 func (Redirect) Status() int { return 0 }
 
-// Handles any errors that occur.
-func (c *Context) handleError(err error) {
-	// Try and hunt the user facing error.
-	var userErr UserFacingError
-	nextErr := err
-	for nextErr != nil {
-		if ue, ok := nextErr.(UserFacingError); ok {
-			userErr = ue
-			break
-		}
-		nextErr = errors.Unwrap(nextErr)
+// WithCookies is used to set cookies alongside the result of a handler. The cookies are set and then the body is
+// handled as if it was returned on its own (so a nil body is still 204 No Content, and a Redirect still redirects).
+type WithCookies struct {
+	Cookies []*http.Cookie
+	Body    any
+}
+
+// Raw is used to send bytes as the body as is, skipping content negotiation. The content type is whatever the handler
+// set with ResponseHeaders, or is sniffed with http.DetectContentType if it isn't set.
+type Raw []byte
+
+// Handles any errors that occur.
+func (c *Context) handleError(err error) {
+	// Turn bad requests into validation errors if the router says to.
+	if c.r.badRequestAsValidation {
+		var br BadRequest
+		if errors.As(err, &br) {
+			if ve, ok := br.ValidationError(); ok {
+				err = ve
+			}
+		}
+	}
+
+	// Try and hunt the user facing error. errors.As also walks errors that wrap multiple errors (such as errors.Join).
+	var userErr UserFacingError
+	if errors.As(err, &userErr) {
+		err = c.consumeHandler(userErr.Status(), userErr.Body())
+		if err == nil {
+			// The error was successfully pushed out to the user.
+			return
+		}
+	}
+
+	// If we have an error handler, use it.
+	if c.r.errHandler != nil {
+		result, status := c.r.errHandler(c, err)
+		if c.consumed {
+			// The error handler wrote the response itself.
+			return
+		}
+		err = c.consumeHandler(status, result)
+		if err == nil {
+			// The error was successfully pushed out to the user.
+			return
+		}
+	}
+
+	// Make the best of a shit situation.
+	status, message := DefaultErrorStatus(err)
+	var unsupported UnsupportedContentType
+	if errors.As(err, &unsupported) {
+		// Tell the client what it can send instead.
+		_ = c.consumeHandler(status, map[string]any{"message": message, "supported": unsupported.Supported})
+		return
+	}
+	_ = c.consumeHandler(status, map[string]string{"message": message})
+}
+
+// Used to consume the context. The main output handler for the web framework.
+func (c *Context) consumeHandler(status int, body any) (err error) {
+	if c.consumed {
+		// We've already consumed the context.
+		return nil
+	}
+
+	// If the status is 204 or 304, we don't need to send anything.
+	if status == 204 || status == 304 {
+		c.w.WriteHeader(status)
+		c.consumed = true
+		return nil
+	}
+
+	// Handle if this is a redirect.
+	if re, ok := body.(*Redirect); ok {
+		if re == nil {
+			return errors.New("nil pointer to special redirect struct")
+		}
+		body = *re
+	}
+	if re, ok := body.(Redirect); ok {
+		if re.SameHostOnly && !sameHostTarget(c.req, re.URL) {
+			return OffSiteRedirect
+		}
+		if re.Flash != "" {
+			if err := c.setFlash(re.Flash); err != nil {
+				return err
+			}
+		}
+		code := re.StatusCode
+		if code == 0 {
+			code = http.StatusTemporaryRedirect
+			if re.Permanent {
+				code = http.StatusPermanentRedirect
+			}
+		}
+		http.Redirect(c.w, c.req, re.URL, code)
+		c.consumed = true
+		return nil
+	}
+
+	// Handle if the body is written by a function. The handler sets the content type if it wants one.
+	if fn, ok := body.(func(io.Writer) error); ok {
+		if c.w.Header().Get("Content-Type") == "" {
+			c.w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		c.w.WriteHeader(status)
+		c.consumed = true
+		if err := fn(c.w); err != nil && c.r.errHandler != nil {
+			// The response has started, so the error can't be sent. Tell the error handler so it can be logged.
+			_, _ = c.r.errHandler(c, StreamError{Err: err})
+		}
+		return nil
+	}
+
+	// Handle if the body is a http.Handler. It writes the whole response itself, so the status is up to it.
+	if h, ok := body.(http.Handler); ok {
+		c.consumed = true
+		h.ServeHTTP(c.w, c.req)
+		return nil
+	}
+
+	// Handle if the body is a file. http.ServeContent handles ranges and conditional requests, and copies the file
+	// with sendfile when the response writer supports it. The file is closed once it is sent.
+	if f, ok := body.(*os.File); ok {
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if stat.IsDir() {
+			return errors.New("cannot send a directory as a response")
+		}
+		c.consumed = true
+		http.ServeContent(c.w, c.req, stat.Name(), stat.ModTime(), f)
+		return nil
+	}
+
+	// Handle if the body is raw bytes.
+	if raw, ok := body.(Raw); ok {
+		contentType := c.w.Header().Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(raw)
+		}
+		c.WriteRaw(status, contentType, raw)
+		return nil
+	}
+
+	// Handles setting the consumed state. If a codec panics (for example, on a cyclic value), this is returned as an
+	// error so that it goes through the error handling rather than panicking again whilst sending an error.
+	defer func() {
+		if v := recover(); v != nil {
+			err = c.panicError(v)
+		}
+		if err == nil {
+			c.consumed = true
+		}
+	}()
+
+	// Find the content type and encode the body as it.
+	var b []byte
+	contentType := "application/json"
+	if !c.r.jsonOnly {
+		contentType = c.negotiateContentType(body)
+		addVary(c.w.Header(), "Accept")
+		if contentType == "" {
+			if status < 400 {
+				return NotAcceptable
+			}
+
+			// Errors still need to get to the client somehow.
+			contentType = "application/json"
+		}
+	}
+	switch contentType {
+	case "application/xml", "text/xml":
+		if b, err = marshalXML(body, c.r.xmlRootElement); err != nil {
+			// encoding/xml can't handle some types at all (such as maps). Rather than a 500, fall back to JSON.
+			var unsupported *xml.UnsupportedTypeError
+			if !errors.As(err, &unsupported) {
+				return
+			}
+			contentType = "application/json"
+			if b, err = json.Marshal(body); err != nil {
+				return
+			}
+		}
+	case "application/x-msgpack", "application/msgpack":
+		var buf bytes.Buffer
+		if err = c.r.newMsgpackEncoder(&buf).Encode(body); err != nil {
+			return
+		}
+		b = buf.Bytes()
+	case "text/plain":
+		switch v := body.(type) {
+		case string:
+			b = []byte(v)
+		case stringer:
+			b = []byte(v.String())
+		default:
+			b = []byte(fmt.Sprintf("%v", body))
+		}
+	case "text/html", "application/html":
+		if b, err = body.(htmler).HTML(); err != nil {
+			return
+		}
+	case "application/x-ndjson":
+		err = c.sendNDJSON(status, body)
+		return
+	case "application/yaml", "text/yaml":
+		if b, err = marshalYAML(body); err != nil {
+			return
+		}
+	case "application/javascript":
+		if b, err = json.Marshal(body); err != nil {
+			return
+		}
+
+		// The leading comment stops the response being interpreted as anything other than JavaScript.
+		b = append([]byte("/**/"+c.jsonpCallback()+"("), append(b, ");"...)...)
+		c.w.Header().Set("X-Content-Type-Options", "nosniff")
+	default:
+		if b, err = json.Marshal(body); err != nil {
+			return
+		}
+	}
+	if !c.trailers {
+		// Trailers need a chunked response, so only set the length without them.
+		c.w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	}
+	c.w.Header().Set("Content-Type", contentType)
+	c.w.WriteHeader(status)
+	_, _ = c.w.Write(b)
+	return nil
+}
+
+// Marshals the body as XML. If root is not blank, the body is wrapped in an element with that name so that types such as
+// slices become a valid XML document.
+func marshalXML(body any, root string) ([]byte, error) {
+	if root == "" {
+		return xml.Marshal(body)
+	}
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	start := xml.StartElement{Name: xml.Name{Local: root}}
+	if err := enc.EncodeToken(start); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(body); err != nil {
+		return nil, err
+	}
+	if err := enc.EncodeToken(start.End()); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// YAMLDocuments is used to return multiple YAML documents separated by "---" rather than a single YAML sequence when
+// YAML is requested. Other content types encode it as a normal slice.
+type YAMLDocuments []any
+
+// Marshals the body as YAML. YAMLDocuments are written as a multi-document stream.
+func marshalYAML(body any) ([]byte, error) {
+	docs, ok := body.(YAMLDocuments)
+	if !ok {
+		return yaml.Marshal(body)
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Defines the interfaces a body needs to implement to be sent as text/plain or text/html.
+type (
+	stringer interface {
+		String() string
+	}
+	htmler interface {
+		HTML() ([]byte, error)
+	}
+)
+
+// Stands in for a body that supports every content type when negotiating without a body.
+type negotiationProbe struct{}
+
+func (negotiationProbe) String() string { return "" }
+
+func (negotiationProbe) HTML() ([]byte, error) { return nil, nil }
+
+// Defines a media range from an Accept header with its q value.
+type acceptPart struct {
+	mediaType string
+	q         float64
+}
+
+// Splits an Accept header into its media ranges in the order they were sent. Parameters other than q are removed.
+func splitAccept(header string) []acceptPart {
+	var parts []acceptPart
+	for _, s := range strings.Split(header, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(s)
+		if err != nil {
+			mediaType = strings.ToLower(strings.TrimSpace(strings.SplitN(s, ";", 2)[0]))
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		parts = append(parts, acceptPart{mediaType: mediaType, q: q})
+	}
+	return parts
+}
+
+// Parses an Accept header into its media types, most preferred first. Types are sorted by their q value (keeping the
+// order they were sent in for ties) and types with a q value of 0 are dropped. Parameters are removed.
+func parseAccept(header string) []string {
+	parts := splitAccept(header)
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].q > parts[j].q
+	})
+
+	types := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.q > 0 {
+			types = append(types, p.mediaType)
+		}
+	}
+	return types
+}
+
+// Accepts reports whether the client accepts the media type (such as "text/html"). Wildcards are honoured, and the
+// most specific matching range decides, so "*/*, text/html;q=0" accepts everything but HTML. Clients that don't send
+// an Accept header accept anything.
+func (c *Context) Accepts(mediaType string) bool {
+	header := c.req.Header.Get("Accept")
+	if header == "" {
+		return true
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0]))
+	majorType := strings.SplitN(mediaType, "/", 2)[0] + "/*"
+
+	// Higher is more specific.
+	specificity := -1
+	q := 0.0
+	for _, p := range splitAccept(header) {
+		s := -1
+		switch p.mediaType {
+		case mediaType:
+			s = 2
+		case majorType:
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s > specificity {
+			specificity = s
+			q = p.q
+		}
+	}
+	return q > 0
+}
+
+// Finds the content type to respond with based on the Accept header (or the Content-Type header if there is none). The
+// body is used to check if text/plain or text/html are possible. If nothing matches, application/json is used. If the
+// client only accepts content types that are disabled or not allowed on this context, a blank string is returned.
+func (c *Context) negotiateContentType(body any) string {
+	// Handle getting the Accept header.
+	accept := c.req.Header.Get("Accept")
+	fromAccept := true
+	if format := c.r.formatOverride(c.req); format != "" {
+		// The query parameter wins over the header.
+		accept = format
+	} else if accept == "" {
+		// Try setting it to the content type.
+		accept = c.req.Header.Get("Content-Type")
+		fromAccept = false
+	}
+
+	// Go through each accepted type in order of preference.
+	rejected := false
+	for _, mediaType := range parseAccept(accept) {
+		// Resolve aliases.
+		contentType := c.r.canonicalContentType(mediaType)
+		match := ""
+		switch contentType {
+		case "application/json":
+			match = "application/json"
+		case "application/*", "*/*":
+			match = "application/json"
+			if c.jsonpCallback() != "" {
+				match = "application/javascript"
+			}
+		case "application/javascript", "text/javascript":
+			if c.jsonpCallback() != "" {
+				match = "application/javascript"
+			}
+		case "application/xml", "text/xml", "application/x-msgpack", "application/msgpack", "application/x-ndjson",
+			"application/yaml", "text/yaml":
+			match = contentType
+		case "text/plain", "text/*":
+			if _, ok := body.(string); ok {
+				match = "text/plain"
+			} else if _, ok := body.(stringer); ok {
+				match = "text/plain"
+			} else if c.r.plainTextFallback && body != nil {
+				match = "text/plain"
+			}
+		case "text/html", "application/html":
+			if _, ok := body.(htmler); ok {
+				match = contentType
+			}
+		}
+		if match == "" {
+			continue
+		}
+		if !c.responseTypeAllowed(match) {
+			// Only hold this against the client if they actually asked for it.
+			rejected = rejected || fromAccept
+			continue
+		}
+		return match
+	}
+
+	// If we get here, we didn't find a matching Accept header. Just give them application/json.
+	if rejected || !c.responseTypeAllowed("application/json") {
+		return ""
+	}
+	return "application/json"
+}
+
+// Checks if a response can be sent as the content type on this context.
+func (c *Context) responseTypeAllowed(contentType string) bool {
+	if c.r.contentTypeDisabled(contentType) {
+		return false
+	}
+	if c.allowedResponseCodecs == nil {
+		return true
+	}
+	_, ok := c.allowedResponseCodecs[codecName(contentType)]
+	return ok
+}
+
+// NegotiatedContentType returns the content type the response will be sent as based on the Accept header. This lets
+// handlers adapt the response before producing it. Since text/plain and text/html also depend on the returned value
+// implementing String or HTML, this assumes that it does. A blank string means the client only accepts content types
+// that are disabled or not allowed.
+func (c *Context) NegotiatedContentType() string {
+	if c.r.jsonOnly {
+		return "application/json"
+	}
+	return c.negotiateContentType(negotiationProbe{})
+}
+
+// Only allows dotted JavaScript identifiers as JSONP callbacks so that the callback can't inject script.
+var jsonpCallbackRegex = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+
+// Gets the JSONP callback for the request. Returns a blank string if JSONP is off or the callback is missing or invalid.
+func (c *Context) jsonpCallback() string {
+	if !c.r.jsonp {
+		return ""
+	}
+	callback := c.req.URL.Query().Get("callback")
+	if len(callback) > 128 || !jsonpCallbackRegex.MatchString(callback) {
+		return ""
+	}
+	return callback
+}
+
+// Adds the header name to the Vary header if it isn't there already. Caches use this to know which request headers the
+// response depends on.
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values("Vary") {
+		for _, existing := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
+
+// Finds the response writer implementing T. Writers that wrap another writer are walked through using their Unwrap
+// method (the same convention net/http uses), so middleware wrapping the router doesn't hide the interface.
+func writerWith[T any](w http.ResponseWriter) (http.ResponseWriter, bool) {
+	for w != nil {
+		if _, ok := any(w).(T); ok {
+			return w, true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	return nil, false
+}
+
+// Streams the body as newline delimited JSON. Receiving channels are read until they are closed or the client goes away,
+// and slices/arrays have each item written as its own line. Anything else is written as a single line.
+func (c *Context) sendNDJSON(status int, body any) error {
+	enc := json.NewEncoder(c.w)
+	writeHeader := func() {
+		c.w.Header().Set("Content-Type", "application/x-ndjson")
+		c.w.WriteHeader(status)
+		c.consumed = true
+	}
+
+	v := reflect.ValueOf(body)
+	switch v.Kind() {
+	case reflect.Chan:
+		if v.Type().ChanDir()&reflect.RecvDir == 0 {
+			return errors.New("cannot stream a send only channel")
+		}
+		w, ok := writerWith[http.Flusher](c.w)
+		if !ok {
+			return FlushingNotSupported
+		}
+		flusher := w.(http.Flusher)
+		writeHeader()
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: v},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Done())},
+		}
+		for {
+			chosen, item, ok := reflect.Select(cases)
+			if chosen == 1 || !ok {
+				// The client went away or the channel was closed.
+				return nil
+			}
+			if err := enc.Encode(item.Interface()); err != nil {
+				return err
+			}
+
+			// Only flush when nothing else is waiting so that bursts get batched into one write.
+			if v.Len() == 0 {
+				flusher.Flush()
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		writeHeader()
+		for i := 0; i < v.Len(); i++ {
+			if err := enc.Encode(v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		writeHeader()
+		_, _ = c.w.Write(append(b, '\n'))
+		return nil
+	}
+}
+
+// Checks if the client has gone away (the request context was cancelled). If it has, the ClientClosedRequest error
+// is passed through the error handling and true is returned so that the caller can stop doing work.
+func (c *Context) clientClosed() bool {
+	if !errors.Is(c.Err(), context.Canceled) {
+		return false
+	}
+	c.handleError(ClientClosedRequest)
+	c.consumed = true
+	return true
+}
+
+// Reads the request body up to the router limit. Any checks that have not run yet are run first, so a request that
+// fails a check (such as authentication) never causes the body to be read unless the check asks for it. If this
+// returns false, the error has been handled already.
+func (c *Context) readBody() ([]byte, bool) {
+	if err := c.runChecks(); err != nil {
+		return nil, false
+	}
+	b, err := c.RawBody()
+	if err != nil {
+		c.handleError(err)
+		return nil, false
+	}
+	return b, true
+}
+
+// Gets a reader for the request body without buffering it. Like readBody, the checks are run first. If the body was
+// already buffered by RawBody, the buffer is used. If this returns false, the error has been handled already.
+func (c *Context) streamBody() (io.Reader, bool) {
+	if err := c.runChecks(); err != nil {
+		return nil, false
+	}
+	if c.bodyRead {
+		if c.bodyErr != nil {
+			c.handleError(c.bodyErr)
+			return nil, false
+		}
+		return bytes.NewReader(c.body), true
+	}
+	c.bodyRead = true
+	c.bodyErr = errors.New("request body was streamed")
+	limit := c.r.bodyLimit()
+	if c.req.ContentLength > int64(limit) {
+		c.handleError(RequestEntityTooLarge)
+		return nil, false
+	}
+	return &limitedBody{r: c.req.Body, n: int64(limit)}, true
+}
+
+// RawBody returns the request body. The body is read once (up to the maximum body size of the router) and buffered,
+// so this can be used from checks (for example, to verify a webhook signature) without stopping the handler decoding
+// it. If the body is too large, RequestEntityTooLarge is returned. If it can't be read, a BadRequest is returned.
+func (c *Context) RawBody() ([]byte, error) {
+	if c.bodyRead {
+		return c.body, c.bodyErr
+	}
+	c.bodyRead = true
+	c.body, c.bodyErr = c.bufferBody()
+
+	// Put the buffer back so anything reading the request directly (such as multipart parsing) still gets the body.
+	c.req.Body = io.NopCloser(bytes.NewReader(c.body))
+	return c.body, c.bodyErr
+}
+
+// Reads the request body into memory up to the router limit.
+func (c *Context) bufferBody() ([]byte, error) {
+	// If the client told us the body is too large, reject it before reading anything. net/http only sends
+	// "100 Continue" to clients using "Expect: 100-continue" once the body is read, so this (and the checks
+	// failing) stops the client from uploading the body at all.
+	limit := c.r.bodyLimit()
+	if c.req.ContentLength > int64(limit) {
+		return nil, RequestEntityTooLarge
 	}
 
-	// If we have a user facing error, use it.
-	if userErr != nil {
-		err = c.consumeHandler(userErr.Status(), userErr.Body())
-		if err == nil {
-			// The error was successfully pushed out to the user.
-			return
-		}
+	// Read the body up to the limit set on the router. One more byte is read so that a body without a Content-Length
+	// (such as a chunked one) that goes over the limit is rejected rather than cut off.
+	b, err := io.ReadAll(io.LimitReader(c.req.Body, int64(limit)+1))
+	if err != nil {
+		return nil, BadRequest{err}
+	}
+	if len(b) > limit {
+		return nil, RequestEntityTooLarge
 	}
 
-	// If we have an error handler, use it.
-	if c.r.errHandler != nil {
-		result, status := c.r.errHandler(c, err)
-		err = c.consumeHandler(status, result)
-		if err == nil {
-			// The error was successfully pushed out to the user.
+	// Make sure we got as much as the client said it would send so that a truncated upload doesn't silently decode
+	// into a partial value. Chunked requests have no Content-Length (-1), so are skipped.
+	if cl := c.req.ContentLength; cl >= 0 && int64(len(b)) != cl {
+		return nil, BadRequest{errors.New("request body does not match the Content-Length header")}
+	}
+	return b, nil
+}
+
+// Runs all checks that have not run yet.
+func (c *Context) runChecks() (err error) {
+	if c.clientClosed() {
+		return ClientClosedRequest
+	}
+	for c.checksRan < len(c.checks) {
+		if err = c.checks[c.checksRan](); err != nil {
+			c.handleError(err)
 			return
 		}
+		c.checksRan++
 	}
+	return
+}
 
-	// Make the best of a shit situation.
-	message := "Internal Server Error"
-	status := 500
-	if errors.Is(err, RouteNotFound) {
-		// Is just a not found error.
-		message = "Not Found"
-		status = 404
-	} else if IsBadRequest(err) {
-		// Is a bad request error.
-		message = "Bad Request"
-		status = 400
+// Recovers from a panic and routes it through the error handling. Must be called with defer.
+func (c *Context) recoverPanic() {
+	if errPossibly := recover(); errPossibly != nil {
+		c.handleError(c.panicError(errPossibly))
 	}
-	_ = c.consumeHandler(status, map[string]string{"message": message})
 }
 
-type wrapsString struct {
-	s string
+// Makes the error for a recovered panic and gives it to the panic logger.
+func (c *Context) panicError(value any) PanicError {
+	err := PanicError{Value: value, Stack: debug.Stack()}
+	if c.r.panicLogger != nil {
+		c.r.panicLogger(c, err)
+	}
+	return err
 }
 
-func (w wrapsString) String() string { return w.s }
+// Responds with 426 Upgrade Required so that the client knows this route is a WebSocket.
+func (c *Context) upgradeRequired() {
+	c.w.Header().Set("Upgrade", "websocket")
+	c.handleError(UpgradeRequired)
+}
 
-// Used to consume the context. The main output handler for the web framework.
-func (c *Context) consumeHandler(status int, body any) (err error) {
+// Executed after a group is done with its function. If the path has been fully consumed, this context is the exact
+// match and its methods take precedence. Otherwise (or if no method consumed the request), the child routes are tried.
+func (c *Context) afterExecute() {
 	if c.consumed {
-		// We've already consumed the context.
-		return nil
+		return
 	}
 
-	// If the status is 204, we don't need to send anything.
-	if status == 204 {
-		c.w.WriteHeader(status)
-		c.consumed = true
-		return nil
-	}
+	// Add panic protection.
+	defer c.recoverPanic()
 
-	// Handle if this is a redirect.
-	if re, ok := body.(*Redirect); ok {
-		if re == nil {
-			return errors.New("nil pointer to special redirect struct")
+	// Handle the exact match.
+	if len(c.pathRemainder) == 0 {
+		c.dispatchMethod()
+		if c.consumed {
+			return
 		}
-		body = *re
 	}
-	if re, ok := body.(Redirect); ok {
-		code := http.StatusTemporaryRedirect
-		if re.Permanent {
-			code = http.StatusPermanentRedirect
+
+	// Try the child routes.
+	if c.dryRun == nil {
+		if err := c.runChecks(); err != nil {
+			return
 		}
-		http.Redirect(c.w, c.req, re.URL, code)
-		c.consumed = true
-		return nil
 	}
-
-	// Handle getting the Accept header.
-	accept := c.req.Header.Get("Accept")
-	if accept == "" {
-		// Try setting it to the content type.
-		accept = c.req.Header.Get("Content-Type")
-		if accept == "" {
-			// Default to JSON.
-			accept = "application/json"
+	for _, h := range c.handlers {
+		ok, remainder, val := h.check(c.req, c.pathRemainder)
+		if ok {
+			// This is the route! Proceed with this.
+			ctx := c.child(remainder)
+			ctx.trace = c.trace.with(h, val)
+			h.execute(ctx, val)
+			if ctx.consumed {
+				// This route consumed it all.
+				return
+			}
 		}
 	}
+}
 
-	// Handles setting the consumed state.
-	defer func() {
-		if err == nil {
-			c.consumed = true
-		}
-	}()
+// Makes the context for a child route.
+func (c *Context) child(remainder []byte) *Context {
+	return &Context{
+		contextBase:   c.contextBase,
+		pathRemainder: remainder,
+		transformers:  c.transformers[:len(c.transformers):len(c.transformers)],
+		tags:          c.tags[:len(c.tags):len(c.tags)],
 
-	// Generally the default, so up here as its own thing.
-	jsonSend := func() error {
-		b, err := json.Marshal(body)
-		if err != nil {
-			return err
-		}
-		c.w.Header().Set("Content-Length", strconv.Itoa(len(b)))
-		c.w.Header().Set("Content-Type", "application/json")
-		c.w.WriteHeader(status)
-		_, _ = c.w.Write(b)
-		return nil
+		allowedResponseCodecs: c.allowedResponseCodecs,
+		cors:                  c.cors,
+	}
+}
+
+// Adds a method runner to the context.
+func (c *Context) addMethod(method string, runner func()) {
+	if c.methods == nil {
+		c.methods = map[string]func(){}
 	}
+	c.methods[method] = runner
+}
 
-	// Split the accept header by comma and go through each part.
-	acceptParts := strings.Split(accept, ",")
-	for _, acceptPart := range acceptParts {
-		// Trim the whitespace.
-		acceptPart = strings.TrimSpace(acceptPart)
+// Checks if the request is a WebSocket upgrade.
+func isWebSocketUpgrade(req *http.Request) bool {
+	return strings.Contains(strings.ToLower(req.Header.Get("Connection")), "upgrade") &&
+		strings.ToLower(req.Header.Get("Upgrade")) == "websocket"
+}
 
-		// Split by semi-colon.
-		acceptPartParts := strings.SplitN(acceptPart, ";", 1)
-		contentType := acceptPartParts[0]
-		switch contentType {
-		case "application/json", "application/*", "*/*":
-			err = jsonSend()
-			return
-		case "application/xml", "text/xml":
-			b, err := xml.Marshal(body)
-			if err != nil {
-				return err
-			}
-			c.w.Header().Set("Content-Length", strconv.Itoa(len(b)))
-			c.w.Header().Set("Content-Type", contentType)
-			c.w.WriteHeader(status)
-			_, _ = c.w.Write(b)
-			return nil
-		case "application/x-msgpack", "application/msgpack":
-			var buf bytes.Buffer
-			if err = msgpack.NewEncoder(&buf).UseJSONTag(true).Encode(body); err != nil {
+// Checks if this context responds to the method (including automatic OPTIONS responses).
+func (c *Context) handlesMethod(method string) bool {
+	if _, ok := c.methods[method]; ok {
+		return true
+	}
+	if c.webSocketUpgrader != nil {
+		return method == "GET" || method == "HEAD" || method == "OPTIONS"
+	}
+	return method == "OPTIONS" && len(c.methods) > 0
+}
+
+// Runs whatever is registered on this context for the request method. Only called when the path is fully consumed.
+func (c *Context) dispatchMethod() {
+	method := c.req.Method
+	if c.dryRun != nil {
+		// Just record that this would have been run.
+		_, ok := c.methods[method]
+		if ok || (c.webSocketUpgrader != nil && method == "GET") {
+			*c.dryRun = *c.trace
+			c.dryRun.matched = true
+			c.dryRun.cors = c.cors
+			c.dryRun.allow = c.allowedMethods()
+			_, c.dryRun.hasOptions = c.methods["OPTIONS"]
+			c.consumed = true
+		}
+		return
+	}
+	if c.handlesMethod(method) {
+		c.setCORSHeaders(c.allowedMethods)
+	}
+	if c.webSocketUpgrader != nil && (method == "GET" || method == "HEAD") {
+		if method == "GET" && isWebSocketUpgrade(c.req) {
+			// Make sure the checks pass before upgrading.
+			if err := c.runChecks(); err != nil {
 				return
 			}
-			c.w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
-			c.w.Header().Set("Content-Type", contentType)
-			c.w.WriteHeader(status)
-			_, _ = c.w.Write(buf.Bytes())
-			return nil
-		case "text/plain", "text/*":
-			type stringer interface {
-				String() string
-			}
-			if s, ok := body.(string); ok {
-				body = wrapsString{s}
-			}
-			if st, ok := body.(stringer); ok {
-				s := st.String()
-				c.w.Header().Set("Content-Length", strconv.Itoa(len(s)))
-				c.w.Header().Set("Content-Type", "text/plain")
-				c.w.WriteHeader(status)
-				_, _ = c.w.Write([]byte(s))
-				return nil
+
+			// Upgrade to a websocket. The upgrader needs to hijack the connection, so find the writer that can.
+			w, ok := writerWith[http.Hijacker](c.w)
+			if !ok {
+				c.handleError(HijackingNotSupported)
+				return
 			}
-		case "text/html", "application/html":
-			type htmler interface {
-				HTML() ([]byte, error)
+			if c.webSocketIdle > 0 {
+				w = &idleHijacker{ResponseWriter: w, timeout: c.webSocketIdle}
 			}
-			var b []byte
-			if ht, ok := body.(htmler); ok {
-				b, err = ht.HTML()
-				if err != nil {
-					return
-				}
-				c.w.Header().Set("Content-Length", strconv.Itoa(len(b)))
-				c.w.Header().Set("Content-Type", contentType)
-				c.w.WriteHeader(status)
-				_, _ = c.w.Write(b)
-				return nil
+			var stats *statsHijacker
+			if c.webSocketStats != nil {
+				stats = &statsHijacker{ResponseWriter: w}
+				w = stats
 			}
-		case "application/yaml", "text/yaml":
-			b, err := yaml.Marshal(body)
+			conn, err := c.webSocketUpgrader.Upgrade(w, c.req, nil)
+			c.consumed = true
 			if err != nil {
-				return err
+				// Return here. This error is a bit special.
+				return
 			}
-			c.w.Header().Set("Content-Length", strconv.Itoa(len(b)))
-			c.w.Header().Set("Content-Type", contentType)
-			c.w.WriteHeader(status)
-			_, _ = c.w.Write(b)
-			return nil
+			if stats != nil {
+				stats.conn.startCounting()
+				defer func() { c.webSocketStats(c, stats.conn.stats()) }()
+			}
+			if err = c.webSocketHandler(conn); err != nil {
+				// Ok fine. The least worse thing here is to not output to the user the error info.
+				c.handleError(err)
+			}
+			return
 		}
-	}
-
-	// If we get here, we didn't find a matching Accept header. Just give them application/json.
-	err = jsonSend()
-	return
-}
 
-// Runs all checks.
-func (c *Context) runChecks() (err error) {
-	for _, check := range c.checks {
-		if err = check(); err != nil {
-			c.handleError(err)
+		// If there is no handler for this method, this route is WebSocket only. Monitoring tools also probe WebSocket
+		// routes with HEAD, so tell them this needs an upgrade rather than a 404.
+		if _, ok := c.methods[method]; !ok {
+			c.upgradeRequired()
 			return
 		}
 	}
-	return
-}
 
-// Executed after a group is done with its function.
-func (c *Context) afterExecute() {
-	if c.consumed {
+	if runner, ok := c.methods[method]; ok {
+		runner()
 		return
 	}
 
-	// Add panic protection.
-	defer func() {
-		if errPossibly := recover(); errPossibly != nil {
-			var err error
-			if errPossibly, ok := errPossibly.(error); ok {
-				err = errPossibly
-			} else {
-				err = fmt.Errorf("%v", errPossibly)
+	// Answer OPTIONS (including CORS preflight requests) for routes that have methods but no OPTIONS handler.
+	if method == "OPTIONS" && c.handlesMethod(method) {
+		c.autoOptions()
+		return
+	}
+
+	// The path matched but the method didn't. Remember what is supported in case nothing else handles the request.
+	if len(c.methods) > 0 {
+		c.matchedMethods = c.allowedMethods()
+	}
+}
+
+var (
+	queryDecoder = schema.NewDecoder()
+	formDecoder  = schema.NewDecoder()
+
+	// Used instead when the router is set to ignore unknown parameters.
+	lenientQueryDecoder = schema.NewDecoder()
+	lenientFormDecoder  = schema.NewDecoder()
+)
+
+func init() {
+	queryDecoder.SetAliasTag("query")
+	formDecoder.SetAliasTag("form")
+	lenientQueryDecoder.SetAliasTag("query")
+	lenientFormDecoder.SetAliasTag("form")
+	lenientQueryDecoder.IgnoreUnknownKeys(true)
+	lenientFormDecoder.IgnoreUnknownKeys(true)
+}
+
+// Decodes query parameters (or a URL encoded form) into the input. Repeated keys are decoded into slice fields. The
+// format query parameter is for the router rather than the input, so it is left out.
+func (c *Context) decodeQuery(v any, values url.Values) error {
+	if name := c.r.formatQueryParam; name != "" && values.Has(name) {
+		filtered := make(url.Values, len(values))
+		for k, vs := range values {
+			if k != name {
+				filtered[k] = vs
 			}
-			c.handleError(err)
 		}
-	}()
+		values = filtered
+	}
+	if c.r.ignoreUnknownParams {
+		return lenientQueryDecoder.Decode(v, values)
+	}
+	return queryDecoder.Decode(v, values)
+}
 
-	if c.req.Method == "GET" {
-		if c.webSocketUpgrader == nil {
-			// Just run the GET handler.
-			if c.getRunner != nil {
-				c.getRunner()
-			}
-		} else if len(c.pathRemainder) == 0 {
-			if strings.Contains(strings.ToLower(c.req.Header.Get("Connection")), "upgrade") &&
-				strings.ToLower(c.req.Header.Get("Upgrade")) == "websocket" {
-				// Upgrade to a websocket.
-				conn, err := c.webSocketUpgrader.Upgrade(c.w, c.req, nil)
-				c.consumed = true
-				if err != nil {
-					// Return here. This error is a bit special.
-					return
-				}
-				if err = c.webSocketHandler(conn); err != nil {
-					// Ok fine. The least worse thing here is to not output to the user the error info.
-					c.handleError(err)
+// Decodes multipart form values into the input. Repeated keys are decoded into slice fields.
+func (c *Context) decodeForm(v any, values map[string][]string) error {
+	if c.r.ignoreUnknownParams {
+		return lenientFormDecoder.Decode(v, values)
+	}
+	return formDecoder.Decode(v, values)
+}
+
+// Reads the values of a multipart form as the body arrives. Like readBody, the checks are run first. Files are counted
+// as they are read rather than kept, so the first file over the maximum file size of the router stops the upload with
+// RequestEntityTooLarge. If this returns false, the error has been handled already.
+func (c *Context) readMultipartForm() (map[string][]string, bool) {
+	body, ok := c.streamBody()
+	if !ok {
+		return nil, false
+	}
+	c.req.Body = io.NopCloser(body)
+	mr, err := c.req.MultipartReader()
+	if err != nil {
+		c.handleError(BadRequest{err})
+		return nil, false
+	}
+
+	values := map[string][]string{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return values, true
+		}
+		if err == nil {
+			if part.FileName() == "" {
+				var b []byte
+				if b, err = io.ReadAll(part); err == nil {
+					values[part.FormName()] = append(values[part.FormName()], string(b))
 				}
-				return
+			} else {
+				err = c.r.discardFile(part)
 			}
-
-			// Run the GET handler.
-			if c.getRunner != nil {
-				c.getRunner()
+		}
+		if err != nil {
+			if !errors.Is(err, RequestEntityTooLarge) {
+				err = BadRequest{err}
 			}
+			c.handleError(err)
+			return nil, false
 		}
 	}
+}
 
-	if err := c.runChecks(); err != nil {
-		return
+// Checks if the query string (or a form body) has more parameters than the router allows. This counts separators
+// rather than parsing so that it is cheap even for huge query strings.
+func (c *Context) tooManyParams(contentType string, body []byte) bool {
+	max := c.r.maxQueryParams
+	if max <= 0 {
+		return false
 	}
-	for _, h := range c.handlers {
-		ok, remainder, val := h.check(c.pathRemainder)
-		if ok {
-			// This is the route! Proceed with this.
-			ctx := &Context{
-				contextBase:   c.contextBase,
-				pathRemainder: remainder,
-			}
-			h.execute(ctx, val)
-			if ctx.consumed {
-				// This route consumed it all.
-				return
-			}
+	count := func(s string) int {
+		if s == "" {
+			return 0
 		}
+		return strings.Count(s, "&") + 1
 	}
+	if count(c.req.URL.RawQuery) > max {
+		return true
+	}
+	return contentType == "application/x-www-form-urlencoded" && count(string(body)) > max
 }
 
-var (
-	queryDecoder = schema.NewDecoder()
-	formDecoder  = schema.NewDecoder()
-)
+// Gets the status and body to send for the result of a handler. Nil results are sent as 204 No Content unless the
+// router is set to send nil slices and maps as empty, nil results as null, or a status for the method.
+func (c *Context) successResponse(result any) (int, any, error) {
+	v := reflect.ValueOf(result)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		if !v.IsNil() {
+			break
+		}
+		if c.r.nilSliceAsEmpty {
+			if v.Kind() == reflect.Slice {
+				return 200, reflect.MakeSlice(v.Type(), 0, 0).Interface(), nil
+			}
+			return 200, reflect.MakeMap(v.Type()).Interface(), nil
+		}
+		return c.nilResponse()
+	case reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+		if v.IsNil() {
+			return c.nilResponse()
+		}
+	case reflect.Invalid:
+		// The result is an untyped nil.
+		return c.nilResponse()
+	}
+	return 200, result, nil
+}
 
-func init() {
-	queryDecoder.SetAliasTag("query")
-	formDecoder.SetAliasTag("form")
+// Gets the status and body to send for a nil result. An error is returned if the method is set to respond to nil
+// results with an error status.
+func (c *Context) nilResponse() (int, any, error) {
+	if status, ok := c.r.nilStatuses[c.req.Method]; ok {
+		if status >= 400 {
+			return 0, nil, HTTPError{Code: status}
+		}
+		return status, nil, nil
+	}
+	if c.r.nilAsNull {
+		return 200, nil, nil
+	}
+	return 204, nil, nil
 }
 
 func methodHandler[T any](c *Context, method string, handler func() (T, error), inputs []any) {
@@ -464,37 +1572,81 @@ func methodHandler[T any](c *Context, method string, handler func() (T, error),
 		return
 	}
 
-	// Run all the checks within this context.
-	if err := c.runChecks(); err != nil {
+	// Handle checking if the remaining path supports this. This is done before the checks so that checks with side
+	// effects only run for the handler that actually consumes the request.
+	if len(c.pathRemainder) > 0 {
+		// This is not ours to consume.
 		return
 	}
 
-	// Handle checking if the remaining path supports this.
-	if len(c.pathRemainder) > 0 {
-		// This is not ours to consume.
+	// Run all the checks within this context.
+	if err := c.runChecks(); err != nil {
 		return
 	}
 
-	// Get the memory limit.
-	limit := c.r.maxBodySize
-	if limit == 0 {
-		// Default to 2MB.
-		limit = 2 * 1024 * 1024
+	// Don't bother decoding the body if the client is gone.
+	if c.clientClosed() {
+		return
 	}
 
 	// Get the content type and if applicable the body.
-	contentType := c.req.Header.Get("Content-Type")
+	contentType := c.r.canonicalContentType(c.req.Header.Get("Content-Type"))
 	var postedBody []byte
+	var bodyStream io.Reader
+	var formValues map[string][]string
 	if method == "GET" {
 		// It doesn't actually matter what the content type is, the type should become application/x-www-form-urlencoded.
 		contentType = "application/x-www-form-urlencoded"
 	} else {
-		// Read the body up to the limit set on the router.
-		postedBody, _ = io.ReadAll(io.LimitReader(c.req.Body, int64(limit)))
+		if c.rawInput {
+			// The body is handed over as is, whatever the content type says it is.
+			contentType = "application/octet-stream"
+		}
+		if c.r.contentTypeDisabled(contentType) {
+			c.handleError(c.r.unsupportedContentType(contentType))
+			return
+		}
+		var ok bool
+		if hasStreamDecoder(inputs) {
+			// The body can only be read once, so any other inputs see an empty body.
+			if bodyStream, ok = c.streamBody(); !ok {
+				return
+			}
+		} else if strings.HasPrefix(contentType, "multipart/form-data") {
+			if formValues, ok = c.readMultipartForm(); !ok {
+				return
+			}
+		} else if postedBody, ok = c.readBody(); !ok {
+			return
+		}
+	}
+
+	// Make sure there aren't too many query or form parameters before anything parses them.
+	if c.tooManyParams(contentType, postedBody) {
+		c.handleError(BadRequest{errors.New("too many query parameters")})
+		return
 	}
 
 	// Go through each input and parse it.
 	for _, v := range inputs {
+		// Query inputs don't care about the body.
+		if q, ok := v.(queryInput); ok {
+			if err := c.BindQuery(q.v); err != nil {
+				c.handleError(err)
+				return
+			}
+			continue
+		}
+
+		// Hand the body straight to stream decoders.
+		if d, ok := v.(StreamDecoder); ok && bodyStream != nil {
+			if err := d.DecodeStream(bodyStream); err != nil {
+				c.handleError(BadRequest{err})
+				return
+			}
+			continue
+		}
+
 		// Check if this is a CSRF validator.
 		csrfValidator := false
 		switch v.(type) {
@@ -528,7 +1680,7 @@ func methodHandler[T any](c *Context, method string, handler func() (T, error),
 				csrfValid = true
 				break
 			}
-			if err := msgpack.NewDecoder(bytes.NewReader(postedBody)).UseJSONTag(true).Decode(v); err != nil {
+			if err := c.r.newMsgpackDecoder(bytes.NewReader(postedBody)).Decode(v); err != nil {
 				c.handleError(BadRequest{err})
 				return
 			}
@@ -560,20 +1712,15 @@ func methodHandler[T any](c *Context, method string, handler func() (T, error),
 			} else {
 				query = c.req.URL.Query()
 			}
-			if err := queryDecoder.Decode(v, query); err != nil {
+			if err := c.decodeQuery(v, query); err != nil {
 				c.handleError(BadRequest{err})
 				return
 			}
 		default:
 			// Handle multipart form data.
 			if strings.HasPrefix(contentType, "multipart/form-data") {
-				if err := c.req.ParseMultipartForm(int64(limit)); err != nil {
-					c.handleError(BadRequest{err})
-					return
-				}
-
 				if csrfValidator {
-					s := c.req.MultipartForm.Value["authenticity_token"]
+					s := formValues["authenticity_token"]
 					if len(s) == 0 {
 						s = []string{""}
 					}
@@ -582,7 +1729,7 @@ func methodHandler[T any](c *Context, method string, handler func() (T, error),
 					break
 				}
 
-				if err := formDecoder.Decode(v, c.req.MultipartForm.Value); err != nil {
+				if err := c.decodeForm(v, formValues); err != nil {
 					c.handleError(BadRequest{err})
 					return
 				}
@@ -597,8 +1744,15 @@ func methodHandler[T any](c *Context, method string, handler func() (T, error),
 				if w, ok := v.(io.Writer); ok {
 					// Write the body to the writer.
 					_, _ = w.Write(postedBody)
+				} else if c.rawInput {
+					c.handleError(errors.New("inputs on a raw input route must implement io.Writer"))
+					return
 				} else {
 					// Assume JSON if there is no content type.
+					if contentType != "" && !c.r.unknownTypeAsJSON {
+						c.handleError(c.r.unsupportedContentType(contentType))
+						return
+					}
 					if err := json.Unmarshal(postedBody, v); err != nil {
 						c.handleError(BadRequest{err})
 						return
@@ -612,27 +1766,68 @@ func methodHandler[T any](c *Context, method string, handler func() (T, error),
 				return
 			}
 		}
+
+		// Let the input validate itself.
+		if val, ok := v.(Validator); ok {
+			if err := validateInput(val); err != nil {
+				c.handleError(err)
+				return
+			}
+		}
 	}
 
 	// Call the handler.
 	result, err := handler()
+
+	// A file result is closed by consumeHandler once it is sent. If the response doesn't get that far (for example,
+	// the client went away or a transformer replaced the body), close it here so the descriptor isn't leaked.
+	var resultBody any = result
+	if wc, ok := resultBody.(WithCookies); ok {
+		resultBody = wc.Body
+	}
+	resultFile, _ := resultBody.(*os.File)
+	defer func() {
+		if resultFile != nil {
+			_ = resultFile.Close()
+		}
+	}()
+
 	if err != nil {
 		c.handleError(err)
 		return
 	}
 
+	// Set any cookies that came with the result.
+	if wc, ok := any(result).(WithCookies); ok {
+		for _, cookie := range wc.Cookies {
+			c.SetCookie(cookie)
+		}
+	}
+
 	// Set the status depending on what this is.
-	status := 200
-	reflectVal := reflect.ValueOf(result)
-	switch reflectVal.Kind() {
-	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Func, reflect.Slice, reflect.Chan:
-		if reflectVal.IsNil() {
-			status = 204
+	status, body, err := c.successResponse(resultBody)
+	if err != nil {
+		c.handleError(err)
+		return
+	}
+	if c.status != 0 {
+		status = c.status
+	}
+	if status != 204 {
+		for i := len(c.transformers) - 1; i >= 0; i-- {
+			body = c.transformers[i](c, body)
 		}
 	}
 
-	// Handle sending the result to the client.
-	err = c.consumeHandler(status, result)
+	// Handle sending the result to the client. If the client went away whilst the handler was running, don't marshal it.
+	if c.clientClosed() {
+		return
+	}
+	if f, ok := body.(*os.File); ok && f == resultFile {
+		// consumeHandler takes ownership of the file.
+		resultFile = nil
+	}
+	err = c.consumeHandler(status, body)
 	if err != nil {
 		c.handleError(err)
 		return
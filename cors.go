@@ -0,0 +1,143 @@
+package discobolt
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions is used to define the cross-origin resource sharing policy used by CORS.
+type CORSOptions struct {
+	// AllowedOrigins are the origins that can make cross-origin requests (such as "https://example.com"). "*" allows
+	// any origin.
+	AllowedOrigins []string
+
+	// AllowedHeaders are the request headers that cross-origin requests can send (such as "Content-Type").
+	AllowedHeaders []string
+
+	// ExposedHeaders are the response headers that cross-origin requests can read.
+	ExposedHeaders []string
+
+	// AllowCredentials is used to allow cookies and authentication on cross-origin requests. When this is on, the
+	// origin is sent back rather than "*".
+	AllowCredentials bool
+
+	// MaxAge is how long browsers can cache the result of a preflight request. Zero leaves it up to the browser.
+	MaxAge time.Duration
+}
+
+// CORS is used to set the cross-origin resource sharing policy for the router or the current route context and any
+// routes inside it. Preflight requests to routes without an OPTIONS handler are answered automatically with the methods
+// registered on the route. This happens before any checks (including global ones) run since browsers don't send
+// credentials with them.
+func CORS(c RouterOrContext, opts CORSOptions) {
+	c.setCORS(&opts)
+}
+
+// Sets the CORS policy on the context.
+func (c *Context) setCORS(opts *CORSOptions) {
+	c.cors = opts
+}
+
+// Sets the CORS policy on the router.
+func (r *Router) setCORS(opts *CORSOptions) {
+	r.cors = opts
+}
+
+// Gets the methods registered on the context in the format used by the Allow header. OPTIONS is always allowed.
+func (c *Context) allowedMethods() string {
+	methods := make([]string, 0, len(c.methods)+2)
+	for method := range c.methods {
+		methods = append(methods, method)
+	}
+	if _, ok := c.methods["GET"]; !ok && c.webSocketUpgrader != nil {
+		methods = append(methods, "GET")
+	}
+	if _, ok := c.methods["OPTIONS"]; !ok {
+		methods = append(methods, "OPTIONS")
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// Checks if this is a CORS preflight request.
+func (c *Context) isPreflight() bool {
+	return c.req.Method == "OPTIONS" && c.req.Header.Get("Origin") != "" &&
+		c.req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// Sets the CORS headers on the response if there is a policy and the origin is allowed by it. The allowed methods are
+// only needed for preflight requests, so they are got lazily.
+func (c *Context) setCORSHeaders(allowedMethods func() string) {
+	origin := c.req.Header.Get("Origin")
+	if c.cors == nil || origin == "" {
+		return
+	}
+	h := c.w.Header()
+	addVary(h, "Origin")
+
+	allowed := ""
+	for _, o := range c.cors.AllowedOrigins {
+		if o == "*" {
+			allowed = "*"
+			if c.cors.AllowCredentials {
+				// Browsers don't allow credentials with a wildcard.
+				allowed = origin
+			}
+			break
+		}
+		if strings.EqualFold(o, origin) {
+			allowed = origin
+			break
+		}
+	}
+	if allowed == "" {
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", allowed)
+	if c.cors.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !c.isPreflight() {
+		if len(c.cors.ExposedHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(c.cors.ExposedHeaders, ", "))
+		}
+		return
+	}
+	h.Set("Access-Control-Allow-Methods", allowedMethods())
+	if len(c.cors.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(c.cors.AllowedHeaders, ", "))
+	}
+	if c.cors.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.cors.MaxAge/time.Second)))
+	}
+}
+
+// Answers an OPTIONS request for a route without an OPTIONS handler with the methods it has.
+func (c *Context) autoOptions() {
+	c.w.Header().Set("Allow", c.allowedMethods())
+	c.w.WriteHeader(204)
+	c.consumed = true
+}
+
+// Answers a preflight request before any checks run if the route it is for has a CORS policy and no OPTIONS handler.
+// This is done with a dry run of the method the browser is asking about, so checks on the way to the route (such as
+// authentication, which browsers don't send with preflight requests) can't reject it. Returns false if the request
+// should be routed as normal.
+func (r *Router) answerPreflight(ctx *Context) bool {
+	probe := ctx.req.Clone(ctx.req.Context())
+	probe.Method = strings.ToUpper(ctx.req.Header.Get("Access-Control-Request-Method"))
+	m := r.dryRun(probe)
+	if !m.matched || m.cors == nil || m.hasOptions {
+		return false
+	}
+
+	ctx.cors = m.cors
+	ctx.setCORSHeaders(func() string { return m.allow })
+	ctx.w.Header().Set("Allow", m.allow)
+	ctx.w.WriteHeader(204)
+	ctx.consumed = true
+	return true
+}
@@ -1,10 +1,170 @@
 package discobolt
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
 
 // RouteNotFound is used to define the error returned when a route is not found.
 var RouteNotFound = errors.New("route not found")
 
+// ClientClosedRequest is used to define the error passed to the error handler when the client goes away before the
+// request is finished. The default error handling maps this to the non-standard 499 status code.
+var ClientClosedRequest = errors.New("client closed request")
+
+// UpgradeRequired is used to define the error returned when a route only supports WebSockets but the request is not
+// a WebSocket upgrade. The default error handling maps this to 426 Upgrade Required.
+var UpgradeRequired = errors.New("upgrade required")
+
+// RequestHeaderFieldsTooLarge is used to define the error returned when a request has more headers than the router
+// allows. The default error handling maps this to 431 Request Header Fields Too Large.
+var RequestHeaderFieldsTooLarge = errors.New("request header fields too large")
+
+// UnderMaintenance is used to define the error returned when the router is in maintenance mode. The default error
+// handling maps this to 503 Service Unavailable.
+var UnderMaintenance = errors.New("under maintenance")
+
+// HTTPSRequired is used to define the error returned when the router requires HTTPS but the request was made over HTTP.
+// The default error handling maps this to 403 Forbidden.
+var HTTPSRequired = errors.New("https required")
+
+// RequestEntityTooLarge is used to define the error returned when the request body is larger than the router allows.
+// The default error handling maps this to 413 Request Entity Too Large.
+var RequestEntityTooLarge = errors.New("request entity too large")
+
+// NotAcceptable is used to define the error returned when every content type the client accepts has been disabled.
+// The default error handling maps this to 406 Not Acceptable.
+var NotAcceptable = errors.New("not acceptable")
+
+// UnsupportedMediaType is used to define the error returned when the request body uses a content type that has been
+// disabled or isn't known. The default error handling maps this to 415 Unsupported Media Type.
+var UnsupportedMediaType = errors.New("unsupported media type")
+
+// UnsupportedContentType is the error given to the error handler when a request body can't be decoded because of its
+// content type. errors.Is reports it as UnsupportedMediaType. The default error handling lists the supported content
+// types in the body.
+type UnsupportedContentType struct {
+	ContentType string
+	Supported   []string
+}
+
+// Error returns the error message.
+func (u UnsupportedContentType) Error() string {
+	return "unsupported media type: " + u.ContentType
+}
+
+// Is returns true for UnsupportedMediaType.
+func (UnsupportedContentType) Is(target error) bool {
+	return target == UnsupportedMediaType
+}
+
+// HandlerTimeout is used to define the error returned when a request takes longer than the handler timeout of the
+// router. The default error handling maps this to 503 Service Unavailable.
+var HandlerTimeout = errors.New("handler timeout")
+
+// IPNotAllowed is used to define the error returned when a request comes from an IP address that AllowIPs or BlockIPs
+// doesn't let through. The default error handling maps this to 403 Forbidden.
+var IPNotAllowed = errors.New("ip address not allowed")
+
+// OffSiteRedirect is used to define the error returned when a redirect with SameHostOnly set points to another host.
+var OffSiteRedirect = errors.New("redirect target is not on the same host")
+
+// HijackingNotSupported is used to define the error returned when a WebSocket upgrade is attempted but the response
+// writer (or anything it wraps) does not implement http.Hijacker. This usually means middleware wrapping the router
+// is hiding it. The default error handling maps this to 500 Internal Server Error with a message saying so.
+var HijackingNotSupported = errors.New("response writer does not support hijacking")
+
+// FlushingNotSupported is used to define the error returned when a response needs to be streamed but the response
+// writer (or anything it wraps) does not implement http.Flusher. The default error handling maps this to 500 Internal
+// Server Error with a message saying so.
+var FlushingNotSupported = errors.New("response writer does not support flushing")
+
+// InvalidSignature is used to define the error returned when a request fails signature verification. The default error
+// handling maps this to 401 Unauthorized.
+var InvalidSignature = errors.New("invalid signature")
+
+// TrailersNotSupported is used to define the error returned when trailers are set on a request that can't have them.
+var TrailersNotSupported = errors.New("trailers are not supported on HTTP/1.0")
+
+// PushNotSupported is used to define the error returned when server push is used on a connection that can't do it.
+// Server push needs HTTP/2 and a server that supports it.
+var PushNotSupported = errors.New("server push is not supported on this connection")
+
+// Defines the status and message the default error handling uses for errors thrown by the framework.
+var frameworkErrors = []struct {
+	err     error
+	status  int
+	message string
+}{
+	{RouteNotFound, http.StatusNotFound, "Not Found"},
+	{RequestEntityTooLarge, http.StatusRequestEntityTooLarge, "Request Entity Too Large"},
+	{UpgradeRequired, http.StatusUpgradeRequired, "Upgrade Required"},
+	{RequestHeaderFieldsTooLarge, http.StatusRequestHeaderFieldsTooLarge, "Request Header Fields Too Large"},
+	{HTTPSRequired, http.StatusForbidden, "Forbidden"},
+	{IPNotAllowed, http.StatusForbidden, "Forbidden"},
+	{UnderMaintenance, http.StatusServiceUnavailable, "Service Unavailable"},
+	{HandlerTimeout, http.StatusServiceUnavailable, "Service Unavailable"},
+	{NotAcceptable, http.StatusNotAcceptable, "Not Acceptable"},
+	{UnsupportedMediaType, http.StatusUnsupportedMediaType, "Unsupported Media Type"},
+	{InvalidSignature, http.StatusUnauthorized, "Unauthorized"},
+	{HijackingNotSupported, http.StatusInternalServerError, "Response Writer Does Not Support Hijacking"},
+	{FlushingNotSupported, http.StatusInternalServerError, "Response Writer Does Not Support Flushing"},
+
+	// The client went away. Nobody will read this, but it gives the error handler a chance to log it.
+	{ClientClosedRequest, 499, "Client Closed Request"},
+}
+
+// DefaultErrorStatus returns the status and message the default error handling uses for the error. This is 400 for bad
+// requests, the matching status for errors thrown by the framework (such as 404, 406, 413, and 415), and 500 for
+// anything else. A custom error handler can use this to keep the framework statuses whilst changing the body.
+func DefaultErrorStatus(err error) (int, string) {
+	for _, fe := range frameworkErrors {
+		if errors.Is(err, fe.err) {
+			return fe.status, fe.message
+		}
+	}
+	if IsBadRequest(err) {
+		return http.StatusBadRequest, "Bad Request"
+	}
+	return http.StatusInternalServerError, "Internal Server Error"
+}
+
+// PanicError is the error given to the error handler when a handler panics. Value is what was passed to panic, and
+// Stack is the stack trace of the goroutine at the time of the panic.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+// Error returns the error message.
+func (p PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Unwrap returns the value passed to panic if it is an error.
+func (p PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// StreamError is the error type given to the error handler when a func(io.Writer) error body fails. The status and
+// part of the body have already been sent by then, so the result of the error handler is thrown away. It is only
+// useful for logging that the client got a cut off response.
+type StreamError struct {
+	Err error
+}
+
+// Unwrap returns the underlying error.
+func (s StreamError) Unwrap() error {
+	return s.Err
+}
+
+// Error returns the error message.
+func (s StreamError) Error() string {
+	return "writing the response body failed: " + s.Err.Error()
+}
+
 // BadRequest is the error type thrown when a bad request is made. It wraps the origin error as to why.
 type BadRequest struct {
 	Err error
@@ -19,3 +179,56 @@ func (b BadRequest) Unwrap() error {
 func (b BadRequest) Error() string {
 	return b.Err.Error()
 }
+
+// HTTPError is a ready-made UserFacingError. If the message is a string, the body sent is in the format
+// {message => <message>}. Otherwise, the message is used as the body as is. If the message is nil, the standard text
+// for the status code is used.
+type HTTPError struct {
+	Code    int
+	Message any
+}
+
+// Status returns the HTTP status code.
+func (e HTTPError) Status() int {
+	return e.Code
+}
+
+// Body returns the body of the error.
+func (e HTTPError) Body() any {
+	switch m := e.Message.(type) {
+	case nil:
+		return map[string]string{"message": http.StatusText(e.Code)}
+	case string:
+		return map[string]string{"message": m}
+	default:
+		return m
+	}
+}
+
+// Error implements the error interface.
+func (e HTTPError) Error() string {
+	if e.Message == nil {
+		return http.StatusText(e.Code)
+	}
+	return fmt.Sprint(e.Message)
+}
+
+// String allows the error to be returned for text/plain.
+func (e HTTPError) String() string {
+	return e.Error()
+}
+
+// NotFound returns a HTTPError with the status 404.
+func NotFound(message any) HTTPError {
+	return HTTPError{Code: http.StatusNotFound, Message: message}
+}
+
+// Forbidden returns a HTTPError with the status 403.
+func Forbidden(message any) HTTPError {
+	return HTTPError{Code: http.StatusForbidden, Message: message}
+}
+
+// Conflict returns a HTTPError with the status 409.
+func Conflict(message any) HTTPError {
+	return HTTPError{Code: http.StatusConflict, Message: message}
+}
@@ -0,0 +1,79 @@
+package discobolt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileResult_Closed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		transform   bool
+		cancel      bool
+		handlerErr  bool
+		status      int
+		body        string
+		withCookies bool
+	}{
+		{name: "sent", status: http.StatusOK, body: "hello"},
+		{name: "sent with cookies", withCookies: true, status: http.StatusOK, body: "hello"},
+		{name: "client went away", cancel: true},
+		{name: "replaced by transformer", transform: true, status: http.StatusOK, body: `"replaced"`},
+		{name: "handler error", handlerErr: true, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f *os.File
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := &Router{}
+			Static(r, "file", func(c *Context) {
+				if tt.transform {
+					AddResponseTransformer(c, func(*Context, any) any {
+						return "replaced"
+					})
+				}
+				GET(c, func() (any, error) {
+					var err error
+					if f, err = os.Open(path); err != nil {
+						return nil, err
+					}
+					if tt.cancel {
+						cancel()
+					}
+					if tt.handlerErr {
+						return f, errors.New("failed")
+					}
+					if tt.withCookies {
+						return WithCookies{Cookies: []*http.Cookie{{Name: "a", Value: "b"}}, Body: f}, nil
+					}
+					return f, nil
+				})
+			})
+
+			req := httptest.NewRequest("GET", "/file", nil).WithContext(ctx)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if tt.status != 0 && (w.Code != tt.status || (tt.body != "" && w.Body.String() != tt.body)) {
+				t.Errorf("expected %d %q, got %d %q", tt.status, tt.body, w.Code, w.Body.String())
+			}
+			if f == nil {
+				t.Fatal("expected the handler to run")
+			}
+			if err := f.Close(); !errors.Is(err, os.ErrClosed) {
+				t.Errorf("expected the file to be closed, but closing it again gave %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package discobolt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// NoCookieSecret is used to define the error returned when a signed cookie is set before the router has a cookie
+// secret. Set one with SetCookieSecret.
+var NoCookieSecret = errors.New("the router has no cookie secret")
+
+// Defines the name of the cookie flash messages are kept in.
+const flashCookieName = "flash"
+
+// SetCookieSecret is used to set the key signed cookies (including flash messages) are signed with. This should be at
+// least 32 random bytes and the same on every instance of the application. Changing it invalidates any signed cookies
+// already given out.
+func (r *Router) SetCookieSecret(secret []byte) {
+	r.cookieSecret = secret
+}
+
+// Signs the cookie value. The name is included so a signed value can't be moved to another cookie.
+func (r *Router) cookieSignature(name, value string) []byte {
+	mac := hmac.New(sha256.New, r.cookieSecret)
+	mac.Write([]byte(name + "=" + value))
+	return mac.Sum(nil)
+}
+
+// SetSignedCookie sets a cookie with a signature so that SignedCookie can tell if the client changed it. The value is
+// not encrypted, so the client can still read it. Returns NoCookieSecret if the router has no cookie secret.
+func (c *Context) SetSignedCookie(cookie *http.Cookie) error {
+	if len(c.r.cookieSecret) == 0 {
+		return NoCookieSecret
+	}
+	value := base64.RawURLEncoding.EncodeToString([]byte(cookie.Value))
+	signature := base64.RawURLEncoding.EncodeToString(c.r.cookieSignature(cookie.Name, value))
+	signed := *cookie
+	signed.Value = value + "." + signature
+	c.SetCookie(&signed)
+	return nil
+}
+
+// SignedCookie returns the value of a cookie set with SetSignedCookie. The boolean is false if the cookie is missing,
+// the signature doesn't match, or the router has no cookie secret.
+func (c *Context) SignedCookie(name string) (string, bool) {
+	if len(c.r.cookieSecret) == 0 {
+		return "", false
+	}
+	cookie, err := c.req.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	value, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return "", false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, c.r.cookieSignature(name, value)) {
+		return "", false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// Sets the flash message for the next request.
+func (c *Context) setFlash(message string) error {
+	return c.SetSignedCookie(&http.Cookie{
+		Name:     flashCookieName,
+		Value:    message,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Flash returns the flash message set by the Flash field of a Redirect on the previous request, and removes it so it
+// is only shown once. Returns a blank string if there isn't one.
+func (c *Context) Flash() string {
+	message, ok := c.SignedCookie(flashCookieName)
+	if !ok {
+		return ""
+	}
+	c.SetCookie(&http.Cookie{Name: flashCookieName, Path: "/", MaxAge: -1})
+	return message
+}
@@ -0,0 +1,73 @@
+package discobolt
+
+// RouteGroup is used to register a named group of root routes with Group. It can be used anywhere a router can.
+type RouteGroup struct {
+	name     string
+	handlers []handler
+	checks   []func(*Context) error
+	cors     *CORSOptions
+}
+
+func (g *RouteGroup) addHandler(h handler) {
+	g.handlers = append(g.handlers, h)
+}
+
+// Checks added to the group only apply to the routes in it.
+func (g *RouteGroup) addContextCheck(check func(*Context) error) {
+	g.checks = append(g.checks, check)
+}
+
+func (g *RouteGroup) setCORS(opts *CORSOptions) {
+	g.cors = opts
+}
+
+// Turns the routes registered on the group into root handlers. The checks and CORS policy of the group are applied
+// to the context before each route runs.
+func (g *RouteGroup) rootHandlers() []handler {
+	handlers := make([]handler, len(g.handlers))
+	for i, h := range g.handlers {
+		execute := h.execute
+		h.execute = func(ctx *Context, val any) {
+			if g.cors != nil {
+				ctx.cors = g.cors
+			}
+			for _, check := range g.checks {
+				ctx.addContextCheck(check)
+			}
+			execute(ctx, val)
+		}
+		h.group = g.name
+		handlers[i] = h
+	}
+	return handlers
+}
+
+// Group is used to register a named group of routes. Calling Group again with the same name replaces the routes in the
+// group, and RemoveGroup removes them. The swap is atomic, so this is safe to do whilst serving requests (for example,
+// for plugins or feature flagged endpoints). Requests that are already running finish with the old routes.
+func (r *Router) Group(name string, fn func(g *RouteGroup)) {
+	g := &RouteGroup{name: name}
+	fn(g)
+	groupHandlers := g.rootHandlers()
+	r.updateHandlers(func(handlers []handler) []handler {
+		return append(withoutGroup(handlers, name), groupHandlers...)
+	})
+}
+
+// RemoveGroup is used to remove the routes registered with Group under the name. This is safe to do whilst serving.
+func (r *Router) RemoveGroup(name string) {
+	r.updateHandlers(func(handlers []handler) []handler {
+		return withoutGroup(handlers, name)
+	})
+}
+
+// Removes the handlers in the group. This filters in place.
+func withoutGroup(handlers []handler, name string) []handler {
+	kept := handlers[:0]
+	for _, h := range handlers {
+		if h.group != name || name == "" {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,48 @@
+package discobolt
+
+// Makes a table from the CIDR ranges. Invalid ranges are a mistake in the code, so they panic.
+func mustCIDRTable(cidrs []string) *cidrTable {
+	t := &cidrTable{}
+	for _, s := range cidrs {
+		ipNet, err := parseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		t.add(ipNet, "")
+	}
+	return t
+}
+
+// AllowIPs adds a check to the router or the current route context that only lets requests from the IP addresses or
+// CIDR ranges given (such as "10.0.0.0/8" or "192.0.2.1") through. The IP is found with RemoteIP, so the real IP is
+// used behind known proxies. Other requests get IPNotAllowed (403 Forbidden by default). Invalid ranges panic.
+func AllowIPs(c RouterOrContext, cidrs []string) {
+	allowed := mustCIDRTable(cidrs)
+	c.addContextCheck(func(ctx *Context) error {
+		ip := ctx.RemoteIP()
+		if ip == nil {
+			return IPNotAllowed
+		}
+		if _, ok := allowed.lookup(ip); !ok {
+			return IPNotAllowed
+		}
+		return nil
+	})
+}
+
+// BlockIPs adds a check to the router or the current route context that turns away requests from the IP addresses or
+// CIDR ranges given with IPNotAllowed (403 Forbidden by default). Like AllowIPs, the IP is found with RemoteIP.
+// Requests where the IP can't be worked out are let through. Invalid ranges panic.
+func BlockIPs(c RouterOrContext, cidrs []string) {
+	blocked := mustCIDRTable(cidrs)
+	c.addContextCheck(func(ctx *Context) error {
+		ip := ctx.RemoteIP()
+		if ip == nil {
+			return nil
+		}
+		if _, ok := blocked.lookup(ip); ok {
+			return IPNotAllowed
+		}
+		return nil
+	})
+}
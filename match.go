@@ -0,0 +1,111 @@
+package discobolt
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Defines the route taken during a dry run.
+type routeMatch struct {
+	matched  bool
+	segments []string
+	params   map[string]any
+
+	// Defines what the matched route allows. This is used to answer CORS preflight requests.
+	cors       *CORSOptions
+	allow      string
+	hasOptions bool
+}
+
+// Returns a copy of the route with the handler added. Nil routes (when this isn't a dry run) stay nil.
+func (m *routeMatch) with(h handler, val any) *routeMatch {
+	if m == nil {
+		return nil
+	}
+	if b, ok := val.([]byte); ok {
+		val = string(b)
+	}
+
+	next := &routeMatch{
+		segments: m.segments[:len(m.segments):len(m.segments)],
+		params:   make(map[string]any, len(m.params)+1),
+	}
+	for k, v := range m.params {
+		next.params[k] = v
+	}
+	switch {
+	case h.pattern != "":
+		if strings.HasPrefix(h.pattern, "{") {
+			next.params[strconv.Itoa(len(next.segments))] = val
+		}
+		next.segments = append(next.segments, h.pattern)
+	case val != nil:
+		// This is a matcher that doesn't match on the path (such as Subdomain).
+		next.params["host"] = val
+	}
+	return next
+}
+
+// Match is used to find what route would handle a request without running it. This is useful for documentation
+// generators and debugging. The path can include a query string, or be an absolute URL to test Host and Subdomain
+// matchers. The pattern uses placeholders for parameters (such as "/users/{int}"), and the params are keyed by the
+// index of the segment in the pattern. Subdomains are keyed as "host".
+//
+// Matcher functions are still called since they are what register the child routes, but checks and methods are not
+// run. The fallback and router-wide gates (such as maintenance mode and global checks) are not considered.
+func (r *Router) Match(method, path string) (matched bool, pattern string, params map[string]any) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return false, "", nil
+	}
+	req := (&http.Request{
+		Method:     strings.ToUpper(method),
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Host:       u.Host,
+		RemoteAddr: "127.0.0.1:0",
+	}).WithContext(context.Background())
+
+	result := r.dryRun(req)
+	if !result.matched {
+		return false, "", nil
+	}
+	return true, "/" + strings.Join(result.segments, "/"), result.params
+}
+
+// Finds the route that would handle the request without running its checks or methods.
+func (r *Router) dryRun(req *http.Request) *routeMatch {
+	result := &routeMatch{}
+	ctx := &Context{
+		contextBase: &contextBase{
+			Context: req.Context(),
+			req:     req,
+			w:       &batchResponseWriter{header: http.Header{}},
+			r:       r,
+			dryRun:  result,
+		},
+		cors:  r.cors,
+		trace: &routeMatch{},
+	}
+	defer ctx.recoverPanic()
+
+	path := req.URL.Path
+	for _, h := range r.loadHandlers() {
+		ok, remainder, val := h.check(req, []byte(path))
+		if ok {
+			routeCtx := ctx.child(remainder)
+			routeCtx.trace = ctx.trace.with(h, val)
+			h.execute(routeCtx, val)
+			if ctx.consumed {
+				break
+			}
+		}
+	}
+	return result
+}
@@ -1,13 +1,18 @@
 package discobolt
 
 import (
+	"net"
+	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
 // RouterOrContext is used to define a interface that can be used for either *Router or *Context.
 type RouterOrContext interface {
 	addHandler(h handler)
+	addContextCheck(check func(*Context) error)
+	setCORS(opts *CORSOptions)
 }
 
 // Consume the part of the path until the next slash. Returns a slice with the contents and the remainder of the path.
@@ -28,7 +33,7 @@ sliceRunner:
 // Static is used to match based on the text content specified.
 func Static(c RouterOrContext, text string, hn func(*Context)) {
 	h := handler{
-		check: func(path []byte) (bool, []byte, any) {
+		check: func(_ *http.Request, path []byte) (bool, []byte, any) {
 			contents, remainder := consumeUntilSlash(path)
 			if string(contents) == text {
 				return true, remainder, nil
@@ -40,6 +45,7 @@ func Static(c RouterOrContext, text string, hn func(*Context)) {
 			ctx.afterExecute()
 		},
 		priority: 2,
+		pattern:  text,
 	}
 	c.addHandler(h)
 }
@@ -47,7 +53,7 @@ func Static(c RouterOrContext, text string, hn func(*Context)) {
 // Int is used to match a signed integer.
 func Int(c RouterOrContext, hn func(*Context, int)) {
 	h := handler{
-		check: func(path []byte) (bool, []byte, any) {
+		check: func(_ *http.Request, path []byte) (bool, []byte, any) {
 			contents, remainder := consumeUntilSlash(path)
 			i, err := strconv.Atoi(string(contents))
 			if err != nil {
@@ -60,6 +66,7 @@ func Int(c RouterOrContext, hn func(*Context, int)) {
 			ctx.afterExecute()
 		},
 		priority: 1,
+		pattern:  "{int}",
 	}
 	c.addHandler(h)
 }
@@ -67,7 +74,7 @@ func Int(c RouterOrContext, hn func(*Context, int)) {
 // Uint is used to match an unsigned integer.
 func Uint(c RouterOrContext, hn func(*Context, uint64)) {
 	h := handler{
-		check: func(path []byte) (bool, []byte, any) {
+		check: func(_ *http.Request, path []byte) (bool, []byte, any) {
 			contents, remainder := consumeUntilSlash(path)
 			i, err := strconv.ParseUint(string(contents), 10, 64)
 			if err != nil {
@@ -80,6 +87,7 @@ func Uint(c RouterOrContext, hn func(*Context, uint64)) {
 			ctx.afterExecute()
 		},
 		priority: 1,
+		pattern:  "{uint}",
 	}
 	c.addHandler(h)
 }
@@ -87,7 +95,7 @@ func Uint(c RouterOrContext, hn func(*Context, uint64)) {
 // Float is used to match a floating point number.
 func Float(c RouterOrContext, hn func(*Context, float64)) {
 	h := handler{
-		check: func(path []byte) (bool, []byte, any) {
+		check: func(_ *http.Request, path []byte) (bool, []byte, any) {
 			contents, remainder := consumeUntilSlash(path)
 			i, err := strconv.ParseFloat(string(contents), 64)
 			if err != nil {
@@ -100,6 +108,7 @@ func Float(c RouterOrContext, hn func(*Context, float64)) {
 			ctx.afterExecute()
 		},
 		priority: 1,
+		pattern:  "{float}",
 	}
 	c.addHandler(h)
 }
@@ -107,7 +116,7 @@ func Float(c RouterOrContext, hn func(*Context, float64)) {
 // String is used to match a string.
 func String(c RouterOrContext, hn func(*Context, string)) {
 	h := handler{
-		check: func(path []byte) (bool, []byte, any) {
+		check: func(_ *http.Request, path []byte) (bool, []byte, any) {
 			contents, remainder := consumeUntilSlash(path)
 			if len(contents) == 0 {
 				return false, path, nil
@@ -123,14 +132,17 @@ func String(c RouterOrContext, hn func(*Context, string)) {
 			ctx.afterExecute()
 		},
 		priority: 1,
+		pattern:  "{string}",
 	}
 	c.addHandler(h)
 }
 
 // Remainder is used to match the remainder of the path when there is more than 1 char after it. Returns the raw result.
+// The context is a normal route context, so any number of methods (and checks) can be registered on it for a catch-all
+// resource.
 func Remainder(c RouterOrContext, hn func(*Context, string)) {
 	h := handler{
-		check: func(path []byte) (bool, []byte, any) {
+		check: func(_ *http.Request, path []byte) (bool, []byte, any) {
 			if len(path) > 1 {
 				return true, []byte{}, path
 			}
@@ -141,6 +153,64 @@ func Remainder(c RouterOrContext, hn func(*Context, string)) {
 			ctx.afterExecute()
 		},
 		priority: 2,
+		pattern:  "{remainder}",
+	}
+	c.addHandler(h)
+}
+
+// Gets the hostname of the request in lower case and without the port.
+func requestHostname(req *http.Request) string {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// Host is used to match based on the Host header of the request. The hostname can start with "*." to match any
+// subdomain (of any depth) of the rest of the hostname, but not the hostname itself. The port is ignored. Host
+// does not consume any of the path, and is checked before any path matchers on the same level.
+func Host(c RouterOrContext, hostname string, hn func(*Context)) {
+	hostname = strings.ToLower(hostname)
+	h := handler{
+		check: func(req *http.Request, path []byte) (bool, []byte, any) {
+			host := requestHostname(req)
+			if strings.HasPrefix(hostname, "*.") {
+				suffix := hostname[1:]
+				if len(host) > len(suffix) && strings.HasSuffix(host, suffix) {
+					return true, path, nil
+				}
+				return false, path, nil
+			}
+			return host == hostname, path, nil
+		},
+		execute: func(ctx *Context, _ any) {
+			hn(ctx)
+			ctx.afterExecute()
+		},
+		priority: 3,
+	}
+	c.addHandler(h)
+}
+
+// Subdomain is used to match requests to a subdomain of the suffix specified and pass the subdomain to the handler.
+// For example, with the suffix "example.com", a request to "acme.example.com" passes "acme". The suffix itself does
+// not match. Like Host, this does not consume any of the path and is checked before any path matchers on the same level.
+func Subdomain(c RouterOrContext, suffix string, hn func(*Context, string)) {
+	suffix = "." + strings.TrimPrefix(strings.ToLower(suffix), ".")
+	h := handler{
+		check: func(req *http.Request, path []byte) (bool, []byte, any) {
+			host := requestHostname(req)
+			if len(host) > len(suffix) && strings.HasSuffix(host, suffix) {
+				return true, path, host[:len(host)-len(suffix)]
+			}
+			return false, path, nil
+		},
+		execute: func(ctx *Context, i any) {
+			hn(ctx, i.(string))
+			ctx.afterExecute()
+		},
+		priority: 3,
 	}
 	c.addHandler(h)
 }
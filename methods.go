@@ -1,12 +1,16 @@
 package discobolt
 
-import "github.com/gorilla/websocket"
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
 
 // GET is used to define a GET request in the current route context.
 func GET[T any](c *Context, handler func() (T, error), inputs ...any) {
-	c.getRunner = func() {
+	c.addMethod("GET", func() {
 		methodHandler(c, "GET", handler, inputs)
-	}
+	})
 }
 
 // WebSocket is used to define a WebSocket request in the current route context.
@@ -15,27 +19,117 @@ func WebSocket(c *Context, upgrader *websocket.Upgrader, handler func(*websocket
 	c.webSocketHandler = handler
 }
 
+// WebSocketOptions is used to define the limits applied to a WebSocket connection. Zero values use the defaults from
+// DefaultWebSocketOptions.
+type WebSocketOptions struct {
+	// ReadLimit is the maximum size in bytes of a message read from the client. Larger messages close the connection.
+	ReadLimit int64
+
+	// ReadTimeout is how long the connection can go without receiving anything from the client before reads fail. The
+	// deadline is pushed back whenever data arrives (messages, pings, and pongs alike), so a quiet client should be
+	// pinged more often than this. A negative value turns the timeout off, which handlers that manage the read deadline
+	// themselves need since it would otherwise be moved on every read.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the initial write deadline. Handlers writing over a long period should extend it with
+	// SetWriteDeadline. Zero means no write deadline.
+	WriteTimeout time.Duration
+
+	// ReadBufferSize and WriteBufferSize set the I/O buffer sizes on the upgrader if it doesn't specify them.
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// OnClose is called with the traffic on the connection once the handler returns. This is useful for metrics.
+	OnClose func(*Context, WebSocketStats)
+}
+
+// DefaultWebSocketOptions are the options used by WebSocketWithOptions for any zero values.
+var DefaultWebSocketOptions = WebSocketOptions{
+	ReadLimit:       1024 * 1024,
+	ReadTimeout:     time.Minute,
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// WebSocketWithOptions is used to define a WebSocket request in the current route context with the limits specified
+// applied to the connection. The upgrader can be nil to use a default one. The upgrader passed in is not mutated.
+func WebSocketWithOptions(c *Context, upgrader *websocket.Upgrader, opts WebSocketOptions, handler func(*websocket.Conn) error) {
+	// Fill in the defaults.
+	if opts.ReadLimit == 0 {
+		opts.ReadLimit = DefaultWebSocketOptions.ReadLimit
+	}
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = DefaultWebSocketOptions.ReadTimeout
+	}
+	if opts.WriteTimeout == 0 {
+		opts.WriteTimeout = DefaultWebSocketOptions.WriteTimeout
+	}
+	if opts.ReadBufferSize == 0 {
+		opts.ReadBufferSize = DefaultWebSocketOptions.ReadBufferSize
+	}
+	if opts.WriteBufferSize == 0 {
+		opts.WriteBufferSize = DefaultWebSocketOptions.WriteBufferSize
+	}
+
+	// Copy the upgrader so we can set the buffer sizes.
+	var u websocket.Upgrader
+	if upgrader != nil {
+		u = *upgrader
+	}
+	if u.ReadBufferSize == 0 {
+		u.ReadBufferSize = opts.ReadBufferSize
+	}
+	if u.WriteBufferSize == 0 {
+		u.WriteBufferSize = opts.WriteBufferSize
+	}
+
+	c.webSocketStats = opts.OnClose
+	if opts.ReadTimeout > 0 {
+		c.webSocketIdle = opts.ReadTimeout
+	}
+	WebSocket(c, &u, func(conn *websocket.Conn) error {
+		conn.SetReadLimit(opts.ReadLimit)
+		if opts.ReadTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(opts.ReadTimeout))
+		}
+		if opts.WriteTimeout > 0 {
+			_ = conn.SetWriteDeadline(time.Now().Add(opts.WriteTimeout))
+		}
+		return handler(conn)
+	})
+}
+
 // POST is used to define a POST request in the current route context.
 func POST[T any](c *Context, handler func() (T, error), inputs ...any) {
-	methodHandler(c, "POST", handler, inputs)
+	c.addMethod("POST", func() {
+		methodHandler(c, "POST", handler, inputs)
+	})
 }
 
 // PUT is used to define a PUT request in the current route context.
 func PUT[T any](c *Context, handler func() (T, error), inputs ...any) {
-	methodHandler(c, "PUT", handler, inputs)
+	c.addMethod("PUT", func() {
+		methodHandler(c, "PUT", handler, inputs)
+	})
 }
 
 // DELETE is used to define a DELETE request in the current route context.
 func DELETE[T any](c *Context, handler func() (T, error), inputs ...any) {
-	methodHandler(c, "DELETE", handler, inputs)
+	c.addMethod("DELETE", func() {
+		methodHandler(c, "DELETE", handler, inputs)
+	})
 }
 
 // PATCH is used to define a PATCH request in the current route context.
 func PATCH[T any](c *Context, handler func() (T, error), inputs ...any) {
-	methodHandler(c, "PATCH", handler, inputs)
+	c.addMethod("PATCH", func() {
+		methodHandler(c, "PATCH", handler, inputs)
+	})
 }
 
 // OPTIONS is used to define a OPTIONS request in the current route context.
 func OPTIONS[T any](c *Context, handler func() (T, error), inputs ...any) {
-	methodHandler(c, "OPTIONS", handler, inputs)
+	c.addMethod("OPTIONS", func() {
+		methodHandler(c, "OPTIONS", handler, inputs)
+	})
 }
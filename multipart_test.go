@@ -0,0 +1,121 @@
+package discobolt
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Counts how much of the body the router read.
+type countingBody struct {
+	r    io.Reader
+	read int
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += n
+	return n, err
+}
+
+func newUploadRouter() *Router {
+	r := &Router{}
+	r.SetMaxFileSize(1024)
+	r.SetMaxBodySize(1024 * 1024)
+	Static(r, "upload", func(ctx *Context) {
+		var in struct {
+			Title string `form:"title"`
+		}
+		POST(ctx, func() (string, error) {
+			return in.Title, nil
+		}, &in)
+	})
+	return r
+}
+
+func newUploadBody(fileSizes ...int) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("title", "hello")
+	for _, size := range fileSizes {
+		fw, _ := mw.CreateFormFile("file", "file.bin")
+		_, _ = fw.Write(bytes.Repeat([]byte("a"), size))
+	}
+	_ = mw.Close()
+	return &body, mw.FormDataContentType()
+}
+
+func TestMultipart_FileSizeLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		fileSizes []int
+		status    int
+	}{
+		{"no files", nil, http.StatusOK},
+		{"file at limit", []int{1024}, http.StatusOK},
+		{"file over limit", []int{2048}, http.StatusRequestEntityTooLarge},
+		{"second file over limit", []int{10, 2048}, http.StatusRequestEntityTooLarge},
+	}
+	r := newUploadRouter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := newUploadBody(tt.fileSizes...)
+			req := httptest.NewRequest("POST", "/upload", body)
+			req.Header.Set("Content-Type", contentType)
+			req.ContentLength = -1
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMultipart_BodyLimit(t *testing.T) {
+	r := newUploadRouter()
+	r.SetMaxBodySize(4096)
+	body, contentType := newUploadBody(1000, 1000, 1000, 1000, 1000)
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMultipart_StopsAtOversizedFile(t *testing.T) {
+	r := newUploadRouter()
+	body, contentType := newUploadBody(2048, 512*1024)
+	total := body.Len()
+	counter := &countingBody{r: body}
+	req := httptest.NewRequest("POST", "/upload", counter)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", w.Code, w.Body.String())
+	}
+	if counter.read >= total/2 {
+		t.Errorf("expected the upload to stop at the oversized file, but %d of %d bytes were read", counter.read, total)
+	}
+}
+
+func TestMultipart_Values(t *testing.T) {
+	r := newUploadRouter()
+	body, contentType := newUploadBody(10)
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "text/plain")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "hello") {
+		t.Errorf("expected the title to be decoded, got %d: %s", w.Code, w.Body.String())
+	}
+}
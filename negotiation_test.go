@@ -0,0 +1,72 @@
+package discobolt
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type benchmarkItem struct {
+	ID   int    `json:"id" xml:"id" yaml:"id"`
+	Name string `json:"name" xml:"name" yaml:"name"`
+}
+
+func TestNegotiation_XMLFallsBackToJSON(t *testing.T) {
+	r := &Router{}
+	Static(r, "settings", func(ctx *Context) {
+		GET(ctx, func() (map[string]string, error) {
+			return map[string]string{"theme": "dark"}, nil
+		})
+	})
+
+	req := httptest.NewRequest("GET", "/settings", nil)
+	req.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %q", ct)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode body %q: %v", w.Body.String(), err)
+	}
+	if !reflect.DeepEqual(body, map[string]string{"theme": "dark"}) {
+		t.Errorf("expected the map as JSON, got %v", body)
+	}
+}
+
+func benchmarkNegotiation(b *testing.B, jsonOnly bool) {
+	r := &Router{}
+	r.SetJSONOnly(jsonOnly)
+	items := []benchmarkItem{{1, "a"}, {2, "b"}, {3, "c"}}
+	Static(r, "items", func(ctx *Context) {
+		GET(ctx, func() ([]benchmarkItem, error) {
+			return items, nil
+		})
+	})
+	req := httptest.NewRequest("GET", "/items", nil)
+	req.Header.Set("Accept", "text/html;q=0.9, application/xml;q=0.8, application/json, */*;q=0.1")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != 200 {
+			b.Fatalf("expected 200, got %d", w.Code)
+		}
+	}
+}
+
+func BenchmarkJSONOnly(b *testing.B) {
+	benchmarkNegotiation(b, true)
+}
+
+func BenchmarkNegotiated(b *testing.B) {
+	benchmarkNegotiation(b, false)
+}
@@ -0,0 +1,127 @@
+package discobolt
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// PageDefaults is used to define the defaults used by Paginate.
+type PageDefaults struct {
+	// Limit is the number of items per page if the limit query parameter is not set. Defaults to 20.
+	Limit int
+
+	// MaxLimit is the maximum number of items per page. Larger limits are clamped to this. Defaults to 100.
+	MaxLimit int
+}
+
+// Reads a positive integer query parameter. Returns 0 if it is not set.
+func positiveQueryParam(c *Context, name string) (int, error) {
+	s := c.req.URL.Query().Get(name)
+	if s == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 1 {
+		return 0, BadRequest{errors.New(name + " must be a positive integer")}
+	}
+	return i, nil
+}
+
+// Paginate reads the page (starting at 1) and limit query parameters and returns the offset and limit to use. The limit
+// is clamped to the maximum. If either parameter is invalid, or the page is so large that the offset would overflow, a
+// BadRequest error is returned.
+func Paginate(c *Context, defaults PageDefaults) (offset, limit int, err error) {
+	if defaults.Limit == 0 {
+		defaults.Limit = 20
+	}
+	if defaults.MaxLimit == 0 {
+		defaults.MaxLimit = 100
+	}
+
+	page, err := positiveQueryParam(c, "page")
+	if err != nil {
+		return 0, 0, err
+	}
+	if page == 0 {
+		page = 1
+	}
+	limit, err = positiveQueryParam(c, "limit")
+	if err != nil {
+		return 0, 0, err
+	}
+	if limit == 0 {
+		limit = defaults.Limit
+	}
+	if limit > defaults.MaxLimit {
+		limit = defaults.MaxLimit
+	}
+	if page-1 > math.MaxInt/limit {
+		// The offset would overflow.
+		return 0, 0, BadRequest{errors.New("page is too large")}
+	}
+	return (page - 1) * limit, limit, nil
+}
+
+// PageLinks is used to define the links to other pages. Links that don't apply (such as the previous page on the
+// first page) are blank.
+type PageLinks struct {
+	Self  string `json:"self" xml:"self" yaml:"self"`
+	First string `json:"first" xml:"first" yaml:"first"`
+	Prev  string `json:"prev,omitempty" xml:"prev,omitempty" yaml:"prev,omitempty"`
+	Next  string `json:"next,omitempty" xml:"next,omitempty" yaml:"next,omitempty"`
+	Last  string `json:"last" xml:"last" yaml:"last"`
+}
+
+// Page is used to define a page of items with pagination metadata. It is made with NewPage.
+type Page[T any] struct {
+	Items []T       `json:"items" xml:"items" yaml:"items"`
+	Total int       `json:"total" xml:"total" yaml:"total"`
+	Page  int       `json:"page" xml:"page" yaml:"page"`
+	Limit int       `json:"limit" xml:"limit" yaml:"limit"`
+	Links PageLinks `json:"links" xml:"links" yaml:"links"`
+}
+
+// NewPage makes a page envelope from the items, the total number of items, and the offset and limit from Paginate.
+// The links keep any other query parameters on the request.
+func NewPage[T any](c *Context, items []T, total, offset, limit int) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	page := offset/limit + 1
+	lastPage := (total + limit - 1) / limit
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	link := func(p int) string {
+		u := *c.req.URL
+		q := u.Query()
+		q.Set("page", strconv.Itoa(p))
+		q.Set("limit", strconv.Itoa(limit))
+		u.RawQuery = q.Encode()
+		return u.RequestURI()
+	}
+	links := PageLinks{
+		Self:  link(page),
+		First: link(1),
+		Last:  link(lastPage),
+	}
+	if page > 1 {
+		links.Prev = link(page - 1)
+	}
+	if page < lastPage {
+		links.Next = link(page + 1)
+	}
+
+	return Page[T]{
+		Items: items,
+		Total: total,
+		Page:  page,
+		Limit: limit,
+		Links: links,
+	}
+}
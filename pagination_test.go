@@ -0,0 +1,56 @@
+package discobolt
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	var offset, limit int
+	r := &Router{}
+	Static(r, "items", func(ctx *Context) {
+		GET(ctx, func() (string, error) {
+			var err error
+			offset, limit, err = Paginate(ctx, PageDefaults{})
+			return "", err
+		})
+	})
+
+	maxPage := math.MaxInt/10 + 1
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		offset int
+		limit  int
+	}{
+		{"defaults", "", http.StatusOK, 0, 20},
+		{"second page", "page=2&limit=10", http.StatusOK, 10, 10},
+		{"limit clamped", "limit=1000", http.StatusOK, 0, 100},
+		{"zero page", "page=0", http.StatusBadRequest, 0, 0},
+		{"negative limit", "limit=-1", http.StatusBadRequest, 0, 0},
+		{"not a number", "page=abc", http.StatusBadRequest, 0, 0},
+		{"largest page", "limit=10&page=" + strconv.Itoa(maxPage), http.StatusOK, (maxPage - 1) * 10, 10},
+		{"page overflows", "limit=10&page=" + strconv.Itoa(maxPage+1), http.StatusBadRequest, 0, 0},
+		{"page overflows int", "page=" + strconv.Itoa(math.MaxInt), http.StatusBadRequest, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, limit = 0, 0
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/items?"+tt.query, nil))
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status == http.StatusOK && (offset != tt.offset || limit != tt.limit) {
+				t.Errorf("expected offset %d and limit %d, got %d and %d", tt.offset, tt.limit, offset, limit)
+			}
+			if offset < 0 {
+				t.Errorf("offset overflowed to %d", offset)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package discobolt
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type tagsInput struct {
+	Tags []string `query:"tags" form:"tags"`
+}
+
+func newTagsRouter() *Router {
+	r := &Router{}
+	Static(r, "tags", func(ctx *Context) {
+		var in tagsInput
+		GET(ctx, func() ([]string, error) {
+			return in.Tags, nil
+		}, &in)
+		POST(ctx, func() ([]string, error) {
+			return in.Tags, nil
+		}, &in)
+	})
+	return r
+}
+
+func multipartTagsRequest(fields [][2]string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, f := range fields {
+		_ = mw.WriteField(f[0], f[1])
+	}
+	_ = mw.Close()
+	req := httptest.NewRequest("POST", "/tags", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func urlEncodedTagsRequest(body string) *http.Request {
+	req := httptest.NewRequest("POST", "/tags", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestParams_RepeatedKeys(t *testing.T) {
+	r := newTagsRouter()
+
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"query", httptest.NewRequest("GET", "/tags?tags=a&tags=b", nil)},
+		{"url encoded form", urlEncodedTagsRequest("tags=a&tags=b")},
+		{"multipart form", multipartTagsRequest([][2]string{{"tags", "a"}, {"tags", "b"}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, tt.req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var tags []string
+			if err := json.Unmarshal(w.Body.Bytes(), &tags); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(tags, []string{"a", "b"}) {
+				t.Errorf("expected [a b], got %v", tags)
+			}
+		})
+	}
+}
+
+func TestParams_UnknownKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		ignore bool
+		status int
+	}{
+		{"rejected by default", false, http.StatusBadRequest},
+		{"ignored when enabled", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTagsRouter()
+			r.SetIgnoreUnknownParams(tt.ignore)
+			reqs := []*http.Request{
+				httptest.NewRequest("GET", "/tags?tags=a&utm_source=x", nil),
+				urlEncodedTagsRequest("tags=a&utm_source=x"),
+				multipartTagsRequest([][2]string{{"tags", "a"}, {"utm_source", "x"}}),
+			}
+			for _, req := range reqs {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != tt.status {
+					t.Errorf("%s: expected %d, got %d: %s", req.Header.Get("Content-Type"), tt.status, w.Code, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestParams_FormatParamNotDecoded(t *testing.T) {
+	r := newTagsRouter()
+	r.SetFormatQueryParam("format")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/tags?tags=a&format=json", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -3,21 +3,18 @@ package discobolt
 import (
 	_ "embed"
 	"net"
+	"net/http"
 	"strings"
 )
 
 //go:embed known_proxies.txt
 var knownProxies string
 
-type cidrItem struct {
-	cidr   *net.IPNet
-	header string
-}
+// Defines the known proxies and the headers they put the real IP in.
+var knownProxyTable cidrTable
 
-var (
-	v4Items = []cidrItem{}
-	v6Items = []cidrItem{}
-)
+// Defines the headers known proxies put the real IP in. The keys are in canonical form.
+var knownProxyHeaders = map[string]struct{}{}
 
 // Turns the known proxies into a table.
 func init() {
@@ -32,39 +29,17 @@ func init() {
 		if len(parts) != 2 {
 			continue
 		}
-		ipRange := parts[0]
-		header := parts[1]
-
-		// Check if this is IPv6.
-		_, ipNet, err := net.ParseCIDR(ipRange)
+		ipNet, err := parseCIDR(parts[0])
 		if err != nil {
 			panic(err)
 		}
-		if ipNet != nil {
-			if ipNet.IP.To4() == nil {
-				v6Items = append(v6Items, cidrItem{ipNet, header})
-			} else {
-				v4Items = append(v4Items, cidrItem{ipNet, header})
-			}
-		}
+		knownProxyTable.add(ipNet, parts[1])
+		knownProxyHeaders[http.CanonicalHeaderKey(parts[1])] = struct{}{}
 	}
 }
 
 // Evaluates the IP and finds if it matches a known proxy. If doesn't, it returns a blank string.
 func evalIp(x net.IP) string {
-	// Check if this is IPv6.
-	if x.To4() == nil {
-		for _, item := range v6Items {
-			if item.cidr.Contains(x) {
-				return item.header
-			}
-		}
-	} else {
-		for _, item := range v4Items {
-			if item.cidr.Contains(x) {
-				return item.header
-			}
-		}
-	}
-	return ""
+	header, _ := knownProxyTable.lookup(x)
+	return header
 }
@@ -0,0 +1,53 @@
+package discobolt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRedirect_SameHostOnly(t *testing.T) {
+	r := &Router{}
+	Static(r, "go", func(ctx *Context) {
+		GET(ctx, func() (Redirect, error) {
+			return Redirect{URL: ctx.URL().Query().Get("to"), SameHostOnly: true}, nil
+		})
+	})
+
+	tests := []struct {
+		name   string
+		target string
+		ok     bool
+	}{
+		{"absolute path", "/dashboard", true},
+		{"relative path", "dashboard?tab=1", true},
+		{"same host", "https://example.com/dashboard", true},
+		{"same host protocol relative", "//example.com/dashboard", true},
+		{"protocol relative", "//evil.com", false},
+		{"protocol relative backslash", "/\\evil.com", false},
+		{"backslashes", "\\\\evil.com", false},
+		{"triple slash", "///evil.com", false},
+		{"leading space", " //evil.com", false},
+		{"scheme with one slash", "http:/evil.com", false},
+		{"scheme without slashes", "http:evil.com", false},
+		{"other host", "https://evil.com/", false},
+		{"javascript", "javascript:alert(1)", false},
+		{"data", "data:text/html,hi", false},
+		{"control character", "/\t/evil.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/go?to="+url.QueryEscape(tt.target), nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if tt.ok {
+				if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") == "" {
+					t.Errorf("expected redirect, got %d", w.Code)
+				}
+			} else if w.Code == http.StatusTemporaryRedirect || w.Header().Get("Location") != "" {
+				t.Errorf("expected off-site redirect to be rejected, got %d to %q", w.Code, w.Header().Get("Location"))
+			}
+		})
+	}
+}
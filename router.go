@@ -1,33 +1,104 @@
 package discobolt
 
 import (
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
 )
 
 // handler is used to define the HTTP handler.
 type handler struct {
 	// check is used to check if the route specified is used by this and consume its part if so.
 	// It returns a boolean for if this is for it, the byte slice for the remainder of the path, and
-	// any magical value it wishes to pass to the handler (useful if this is a user param).
-	check func(path []byte) (bool, []byte, any)
+	// any magical value it wishes to pass to the handler (useful if this is a user param). The request
+	// is passed in for matchers that don't match on the path.
+	check func(req *http.Request, path []byte) (bool, []byte, any)
 
 	// execute is used to execute the handler. The any is from the check above.
 	execute func(*Context, any)
 
 	// priority is used to define the priority. Routes with the highest priority should be executed first.
 	priority int
+
+	// group is used to define the name of the route group this was added in. It is blank for routes not in a group.
+	group string
+
+	// pattern is used to describe the path segment this matches for Match (such as "users" or "{int}"). It is blank for
+	// matchers that don't match on the path.
+	pattern string
 }
 
 // ErrorHandler is used to used to define the error handler. The any is the error result that should be returned to the user.
+// If the handler writes the response itself (with WriteRaw), the result is ignored.
 type ErrorHandler func(*Context, error) (result any, status int)
 
-// Router is used to define the base router.
+// Router is used to define the base router. Routes and checks can be added from multiple goroutines and whilst serving
+// requests. Other settings (such as the error handler) should be set before the router starts serving.
 type Router struct {
-	handlers         []handler
-	errHandler       ErrorHandler
-	maxBodySize      int
-	disableAutoProxy bool
+	errHandler             ErrorHandler
+	maxBodySize            int
+	maxBatchSize           int
+	maxFileSize            int
+	disableAutoProxy       bool
+	fallback               func(*Context)
+	maxHeaderCount         int
+	maxQueryParams         int
+	requireHTTPS           bool
+	httpsRedirect          bool
+	rejectAbsoluteURI      bool
+	strictSlash            bool
+	xmlRootElement         string
+	plainTextFallback      bool
+	nilSliceAsEmpty        bool
+	nilAsNull              bool
+	nilStatuses            map[string]int
+	badRequestAsValidation bool
+	unknownTypeAsJSON      bool
+	ignoreUnknownParams    bool
+	jsonp                  bool
+	jsonOnly               bool
+	formatQueryParam       string
+	handlerTimeout         time.Duration
+	cookieSecret           []byte
+	compression            bool
+	compressionSkipTypes   []string
+	disabledCodecs         map[string]struct{}
+	contentTypeAliases     map[string]string
+	panicLogger            func(*Context, PanicError)
+	devBodyLogger          func(*Context, BodyLog)
+	devBodyLogSize         int
+	cors                   *CORSOptions
+	msgpackEncConfig       func(*msgpack.Encoder)
+	msgpackDecConfig       func(*msgpack.Decoder)
+
+	// routes holds the []handler for the root routes, globalChecks holds the []Check added with AddGlobalCheck, and
+	// contextChecks holds the []func(*Context) error for checks that need the context. They are replaced as a whole
+	// (copy on write) under the lock so that registering is safe whilst requests are being served.
+	routes        atomic.Value
+	globalChecks  atomic.Value
+	contextChecks atomic.Value
+	registerLock  sync.Mutex
+
+	// conns is used to count the requests on each connection by remote address. This is filled by the ConnState hook.
+	conns sync.Map
+
+	// maintenance is used to define the maintenance mode state. It has its own lock since it is toggled whilst serving.
+	maintenance struct {
+		sync.RWMutex
+		enabled      bool
+		retryAfter   time.Duration
+		allowedPaths map[string]struct{}
+	}
 }
 
 // SetErrorHandler is used to set the error handler.
@@ -35,11 +106,366 @@ func (r *Router) SetErrorHandler(h ErrorHandler) {
 	r.errHandler = h
 }
 
+// SetPanicLogger is used to set a function that is called with the stack trace when a handler panics. This is called
+// before the error handler, so the panic can be logged even if the error handler hides the details from the user.
+func (r *Router) SetPanicLogger(logger func(*Context, PanicError)) {
+	r.panicLogger = logger
+}
+
+// AddGlobalCheck adds a check that runs for every request before any route matching. A failing check goes through the
+// usual error handling. This is useful for cross-cutting gates.
+func (r *Router) AddGlobalCheck(check Check) {
+	r.registerLock.Lock()
+	defer r.registerLock.Unlock()
+	checks, _ := r.globalChecks.Load().([]Check)
+	r.globalChecks.Store(append(checks[:len(checks):len(checks)], check))
+}
+
+// GlobalChecks returns a copy of the global checks in the order they run.
+func (r *Router) GlobalChecks() []Check {
+	current, _ := r.globalChecks.Load().([]Check)
+	checks := make([]Check, len(current))
+	copy(checks, current)
+	return checks
+}
+
+// SetMaintenanceMode is used to toggle maintenance mode. When enabled, all requests except the allowed paths get a
+// 503 with a Retry-After header (if retryAfter is above 0). This is safe to call whilst serving requests.
+func (r *Router) SetMaintenanceMode(enabled bool, retryAfter time.Duration) {
+	r.maintenance.Lock()
+	r.maintenance.enabled = enabled
+	r.maintenance.retryAfter = retryAfter
+	r.maintenance.Unlock()
+}
+
+// SetMaintenanceAllowedPaths sets the paths that still work during maintenance mode (such as health checks). The paths
+// must match the request path exactly.
+func (r *Router) SetMaintenanceAllowedPaths(paths ...string) {
+	allowedPaths := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		allowedPaths[p] = struct{}{}
+	}
+	r.maintenance.Lock()
+	r.maintenance.allowedPaths = allowedPaths
+	r.maintenance.Unlock()
+}
+
+// Checks if the request is blocked by maintenance mode. If it is, the Retry-After header is set and the error returned.
+func (r *Router) maintenanceCheck(ctx *Context) error {
+	r.maintenance.RLock()
+	defer r.maintenance.RUnlock()
+	if !r.maintenance.enabled {
+		return nil
+	}
+	if _, ok := r.maintenance.allowedPaths[ctx.req.URL.Path]; ok {
+		return nil
+	}
+	if r.maintenance.retryAfter > 0 {
+		seconds := int(r.maintenance.retryAfter.Round(time.Second) / time.Second)
+		ctx.w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+	return UnderMaintenance
+}
+
+// SetXMLRootElement sets the name of an element to wrap all XML responses in (for example, "response"). This makes
+// types such as slices serialize to valid XML documents. A blank string (the default) means no wrapping.
+func (r *Router) SetXMLRootElement(name string) {
+	r.xmlRootElement = name
+}
+
+// SetPlainTextFallback is used to allow any type to be sent as text/plain using fmt when it doesn't implement String.
+// This is off by default, meaning those types are sent as JSON instead. This is useful for debugging with curl.
+func (r *Router) SetPlainTextFallback(enabled bool) {
+	r.plainTextFallback = enabled
+}
+
+// SetNilSliceAsEmpty is used to send nil slices and maps returned by handlers as an empty array or object with the
+// status 200. By default, they are sent as 204 No Content like any other nil result.
+func (r *Router) SetNilSliceAsEmpty(enabled bool) {
+	r.nilSliceAsEmpty = enabled
+}
+
+// SetNilAsNull is used to send nil results returned by handlers as null with the status 200 rather than 204 No Content.
+// Nil slices and maps are sent as empty instead if SetNilSliceAsEmpty is turned on.
+func (r *Router) SetNilAsNull(enabled bool) {
+	r.nilAsNull = enabled
+}
+
+// SetNilStatus is used to set the status for nil results returned by handlers of the method, overriding the default
+// for that method (for example, 404 for GET whilst DELETE keeps 204). Error statuses (400 and up) are handled as a
+// HTTPError with the status, so they go through the error handler. Other statuses are sent with a null body (or an
+// empty one for 204 and 304). A status of 0 goes back to the default.
+func (r *Router) SetNilStatus(method string, status int) {
+	if r.nilStatuses == nil {
+		r.nilStatuses = map[string]int{}
+	}
+	if status == 0 {
+		delete(r.nilStatuses, method)
+		return
+	}
+	r.nilStatuses[method] = status
+}
+
+// EnableJSONP is used to allow JSON responses to be wrapped in a JavaScript callback for legacy clients. When enabled,
+// requests with a valid callback query parameter that accept application/javascript (or anything) get the JSON wrapped
+// in a call to it. Invalid callback names are ignored and plain JSON is sent. This is off by default.
+func (r *Router) EnableJSONP(enabled bool) {
+	r.jsonp = enabled
+}
+
+// Maps the content types that share a codec to one name so that disabling a content type also disables its aliases.
+var contentTypeCodecs = map[string]string{
+	"application/json":       "json",
+	"application/xml":        "xml",
+	"text/xml":               "xml",
+	"application/x-msgpack":  "msgpack",
+	"application/msgpack":    "msgpack",
+	"application/yaml":       "yaml",
+	"text/yaml":              "yaml",
+	"text/html":              "html",
+	"application/html":       "html",
+	"application/javascript": "javascript",
+	"text/javascript":        "javascript",
+}
+
+// SetJSONOnly is used to skip content negotiation for responses and always send JSON. This saves parsing the Accept
+// header on every request for APIs that only speak JSON. Functions and Raw bodies are still sent as is, and request
+// bodies are decoded as normal.
+func (r *Router) SetJSONOnly(enabled bool) {
+	r.jsonOnly = enabled
+}
+
+// Defines the short names that can be given in the format query parameter and the content types they select.
+var formatNames = map[string]string{
+	"json":    "application/json",
+	"xml":     "application/xml",
+	"yaml":    "application/yaml",
+	"yml":     "application/yaml",
+	"msgpack": "application/msgpack",
+	"ndjson":  "application/x-ndjson",
+	"text":    "text/plain",
+	"txt":     "text/plain",
+	"html":    "text/html",
+	"jsonp":   "application/javascript",
+}
+
+// SetFormatQueryParam is used to let a query parameter (such as "format") override the Accept header, which is handy
+// for looking at an API in a browser. The value can be a short name (json, xml, yaml, msgpack, ndjson, text, html, or
+// jsonp) or a content type. Unknown values are ignored and the Accept header is used. Blank turns this off.
+func (r *Router) SetFormatQueryParam(name string) {
+	r.formatQueryParam = name
+}
+
+// Gets the content type the format query parameter asks for. Returns a blank string if there isn't a valid one.
+func (r *Router) formatOverride(req *http.Request) string {
+	if r.formatQueryParam == "" {
+		return ""
+	}
+	format := strings.ToLower(strings.TrimSpace(req.URL.Query().Get(r.formatQueryParam)))
+	if format == "" {
+		return ""
+	}
+	if contentType, ok := formatNames[format]; ok {
+		return contentType
+	}
+	contentType := r.canonicalContentType(format)
+	for _, known := range formatNames {
+		if codecName(known) == codecName(contentType) {
+			return contentType
+		}
+	}
+	return ""
+}
+
+// DisableContentTypes is used to turn off content types for both request bodies and responses (for example,
+// "application/yaml" to remove the YAML parser from the attack surface). Aliases such as text/yaml are disabled along
+// with them. Request bodies of a disabled type get 415 Unsupported Media Type, and clients that only accept disabled
+// types get 406 Not Acceptable. Error responses are still sent as JSON.
+func (r *Router) DisableContentTypes(types ...string) {
+	if r.disabledCodecs == nil {
+		r.disabledCodecs = map[string]struct{}{}
+	}
+	for codec := range codecSet(types) {
+		r.disabledCodecs[codec] = struct{}{}
+	}
+}
+
+// Gets the codec name for the content type. Any parameters on the content type are ignored, and content types without
+// aliases are their own codec.
+func codecName(contentType string) string {
+	contentType = strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	if codec, ok := contentTypeCodecs[contentType]; ok {
+		return codec
+	}
+	return contentType
+}
+
+// Makes a set of the codecs for the content types.
+func codecSet(types []string) map[string]struct{} {
+	codecs := make(map[string]struct{}, len(types))
+	for _, t := range types {
+		codecs[codecName(t)] = struct{}{}
+	}
+	return codecs
+}
+
+// Checks if the content type has been disabled.
+func (r *Router) contentTypeDisabled(contentType string) bool {
+	if len(r.disabledCodecs) == 0 {
+		return false
+	}
+	_, disabled := r.disabledCodecs[codecName(r.canonicalContentType(contentType))]
+	return disabled
+}
+
+// AddContentTypeAlias is used to treat a content type as another one that is supported (for example, "text/json" or
+// "application/vnd.api+json" as "application/json"). This applies to both request bodies and the Accept header.
+// Responses are sent with the canonical content type.
+func (r *Router) AddContentTypeAlias(alias, canonical string) {
+	if r.contentTypeAliases == nil {
+		r.contentTypeAliases = map[string]string{}
+	}
+	r.contentTypeAliases[strings.ToLower(alias)] = strings.ToLower(canonical)
+}
+
+// Gets the media type of the content type without any parameters (such as charset) in lower case, with any aliases
+// resolved.
+func (r *Router) canonicalContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	}
+	if canonical, ok := r.contentTypeAliases[mediaType]; ok {
+		return canonical
+	}
+	return mediaType
+}
+
+// SetBadRequestAsValidationError is used to send bad requests that say which fields were wrong (such as a JSON field
+// with the wrong type) as a ValidationError with the status 422. By default, they are sent as 400 Bad Request.
+func (r *Router) SetBadRequestAsValidationError(enabled bool) {
+	r.badRequestAsValidation = enabled
+}
+
+// SetIgnoreUnknownParams is used to ignore query and form keys that don't match a field in the input (such as tracking
+// parameters or the authenticity token). By default, they are rejected with 400 Bad Request.
+func (r *Router) SetIgnoreUnknownParams(enabled bool) {
+	r.ignoreUnknownParams = enabled
+}
+
+// SetUnknownContentTypeAsJSON is used to decode request bodies with a content type the router doesn't know as JSON. By
+// default, they are rejected with 415 Unsupported Media Type. Bodies without a content type are always decoded as JSON.
+func (r *Router) SetUnknownContentTypeAsJSON(enabled bool) {
+	r.unknownTypeAsJSON = enabled
+}
+
+// Defines the content types request bodies can be decoded from, in the order they are listed to clients.
+var requestContentTypes = []string{
+	"application/json",
+	"application/xml",
+	"text/xml",
+	"application/x-msgpack",
+	"application/msgpack",
+	"application/yaml",
+	"text/yaml",
+	"application/x-www-form-urlencoded",
+	"multipart/form-data",
+}
+
+// Gets the error for a request body the router can't decode. This lists the content types that are enabled.
+func (r *Router) unsupportedContentType(contentType string) UnsupportedContentType {
+	supported := make([]string, 0, len(requestContentTypes))
+	for _, t := range requestContentTypes {
+		if !r.contentTypeDisabled(t) {
+			supported = append(supported, t)
+		}
+	}
+	return UnsupportedContentType{ContentType: contentType, Supported: supported}
+}
+
+// ConfigureMsgpack is used to customize the msgpack encoder and decoder (for example, to use compact encoding or encode
+// structs as arrays). The functions are called on every new encoder/decoder after JSON tags are turned on. Either can
+// be nil to leave it alone.
+func (r *Router) ConfigureMsgpack(enc func(*msgpack.Encoder), dec func(*msgpack.Decoder)) {
+	r.msgpackEncConfig = enc
+	r.msgpackDecConfig = dec
+}
+
+// Makes a msgpack encoder with the router configuration.
+func (r *Router) newMsgpackEncoder(w io.Writer) *msgpack.Encoder {
+	enc := msgpack.NewEncoder(w).UseJSONTag(true)
+	if r.msgpackEncConfig != nil {
+		r.msgpackEncConfig(enc)
+	}
+	return enc
+}
+
+// Makes a msgpack decoder with the router configuration.
+func (r *Router) newMsgpackDecoder(rd io.Reader) *msgpack.Decoder {
+	dec := msgpack.NewDecoder(rd).UseJSONTag(true)
+	if r.msgpackDecConfig != nil {
+		r.msgpackDecConfig(dec)
+	}
+	return dec
+}
+
+// SetMaxHeaderCount sets the maximum number of header values a request can have before it is rejected with 431 Request
+// Header Fields Too Large. net/http limits the size of the headers but not how many there are. 0 means unlimited.
+func (r *Router) SetMaxHeaderCount(n int) {
+	r.maxHeaderCount = n
+}
+
+// SetMaxQueryParams sets the maximum number of query parameters (and parameters in form bodies) a request can have
+// before it is rejected with 400 Bad Request. Repeated keys each count. This stops clients making decoding slow with
+// thousands of parameters. 0 means unlimited.
+func (r *Router) SetMaxQueryParams(n int) {
+	r.maxQueryParams = n
+}
+
+// SetMaxBatchSize sets the maximum number of sub-requests a batch made with Batch can have before it is rejected with
+// 400 Bad Request. 0 means the default of 20.
+func (r *Router) SetMaxBatchSize(n int) {
+	r.maxBatchSize = n
+}
+
 // SetMaxBodySize sets the maximum body size for the router. 0 means the default of 2MB.
 func (r *Router) SetMaxBodySize(size int) {
 	r.maxBodySize = size
 }
 
+// SetMaxFileSize sets the maximum size of a single file in a multipart form. The form is read as it arrives, so a request
+// is rejected with 413 Request Entity Too Large as soon as a file goes over this, without waiting for the rest of the
+// upload. The whole body is still limited by the maximum body size. 0 means no limit other than that.
+func (r *Router) SetMaxFileSize(size int) {
+	r.maxFileSize = size
+}
+
+// Reads a file in a multipart form, counting the bytes as they arrive. Returns RequestEntityTooLarge as soon as the
+// file goes over the maximum file size.
+func (r *Router) discardFile(file io.Reader) error {
+	if r.maxFileSize <= 0 {
+		_, err := io.Copy(io.Discard, file)
+		return err
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(file, int64(r.maxFileSize)+1))
+	if err != nil {
+		return err
+	}
+	if n > int64(r.maxFileSize) {
+		return RequestEntityTooLarge
+	}
+	return nil
+}
+
+// Gets the maximum body size, applying the default if it isn't set.
+func (r *Router) bodyLimit() int {
+	if r.maxBodySize == 0 {
+		// Default to 2MB.
+		return 2 * 1024 * 1024
+	}
+	return r.maxBodySize
+}
+
 type routesSorter struct {
 	a []handler
 }
@@ -57,8 +483,33 @@ func (s routesSorter) Less(i, j int) bool {
 }
 
 func (r *Router) addHandler(h handler) {
-	r.handlers = append(r.handlers, h)
-	sort.Sort(routesSorter{a: r.handlers})
+	r.updateHandlers(func(handlers []handler) []handler {
+		return append(handlers, h)
+	})
+}
+
+// Gets the current root handlers. The slice must not be modified.
+func (r *Router) loadHandlers() []handler {
+	handlers, _ := r.routes.Load().([]handler)
+	return handlers
+}
+
+// Replaces the root handlers with the result of the function. The function is given a copy, so it can modify it.
+func (r *Router) updateHandlers(fn func([]handler) []handler) {
+	r.registerLock.Lock()
+	defer r.registerLock.Unlock()
+	current := r.loadHandlers()
+	handlers := fn(append(make([]handler, 0, len(current)+1), current...))
+	sort.Sort(routesSorter{a: handlers})
+	r.routes.Store(handlers)
+}
+
+// Adds a check that needs the context. These run after the global checks.
+func (r *Router) addContextCheck(check func(*Context) error) {
+	r.registerLock.Lock()
+	defer r.registerLock.Unlock()
+	checks, _ := r.contextChecks.Load().([]func(*Context) error)
+	r.contextChecks.Store(append(checks[:len(checks):len(checks)], check))
 }
 
 // UserFacingError is used to define a user facing error.
@@ -72,28 +523,138 @@ type UserFacingError interface {
 
 // ServeHTTP implements the http.Handler interface.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	// Turn the path into a byte slice.
-	path := []byte(req.URL.Path)
+	start := time.Now()
+
+	// Compress the response if the content type benefits from it. This is closed after any panic is handled.
+	if r.compression {
+		cw := &compressWriter{ResponseWriter: w, r: r, acceptsGzip: acceptsGzip(req)}
+		defer cw.close()
+		w = cw
+	}
+
+	// Record the response for the body logger. This goes outside of compression so the logged body is readable.
+	var recorder *recordingWriter
+	if r.devBodyLogger != nil {
+		recorder = &recordingWriter{ResponseWriter: w, max: r.devBodyLogSize}
+		w = recorder
+	}
 
-	// Get the context.
-	ctx := &Context{
+	// Run the handler with a timeout if there is one. WebSockets are long lived, so they are left alone.
+	if r.handlerTimeout > 0 && !isWebSocketUpgrade(req) {
+		ctx := r.serveWithTimeout(w, req, start)
+		if recorder != nil {
+			r.logBodies(ctx, recorder)
+		}
+		return
+	}
+
+	// Log the bodies once the response is done (including any panic response).
+	ctx := r.newContext(w, req, start)
+	if recorder != nil {
+		defer r.logBodies(ctx, recorder)
+	}
+	r.serve(ctx)
+}
+
+// Makes the root context for a request.
+func (r *Router) newContext(w http.ResponseWriter, req *http.Request, start time.Time) *Context {
+	return &Context{
 		contextBase: &contextBase{
 			Context:  req.Context(),
 			req:      req,
 			w:        w,
 			r:        r,
+			start:    start,
 			consumed: false,
 		},
-		pathRemainder: path,
+		pathRemainder: []byte(req.URL.Path),
+		cors:          r.cors,
+	}
+}
+
+// Routes the request for the root context.
+func (r *Router) serve(ctx *Context) {
+	req := ctx.req
+	path := ctx.pathRemainder
+
+	// Add panic protection. This covers matchers and anything not inside of afterExecute.
+	defer ctx.recoverPanic()
+
+	// Reject requests with too many headers.
+	if r.maxHeaderCount > 0 {
+		count := 0
+		for _, v := range req.Header {
+			count += len(v)
+		}
+		if count > r.maxHeaderCount {
+			ctx.handleError(RequestHeaderFieldsTooLarge)
+			return
+		}
+	}
+
+	// Handle absolute-form request URIs. req.URL.Path is just the path for these, so they route like any other request.
+	if r.rejectAbsoluteURI && req.URL.IsAbs() {
+		ctx.handleError(BadRequest{errors.New("absolute-form request URIs are not allowed")})
+		return
+	}
+
+	// Handle empty path segments. Matchers skip these, so without strict slashes "/users//5" routes like "/users/5".
+	if r.strictSlash && strings.Contains(req.URL.Path, "//") {
+		ctx.handleError(BadRequest{errors.New("path contains an empty segment")})
+		return
+	}
+
+	// Handle requiring HTTPS.
+	if r.requireHTTPS && !ctx.isHTTPS() {
+		if r.httpsRedirect {
+			// Only use the path and query in case the request URI is in absolute-form.
+			target := url.URL{Path: req.URL.Path, RawPath: req.URL.RawPath, RawQuery: req.URL.RawQuery}
+			ctx.handleError(Redirect{
+				URL:        "https://" + req.Host + target.RequestURI(),
+				StatusCode: http.StatusMovedPermanently,
+			})
+		} else {
+			ctx.handleError(HTTPSRequired)
+		}
+		return
+	}
+
+	// Handle maintenance mode.
+	if err := r.maintenanceCheck(ctx); err != nil {
+		ctx.handleError(err)
+		return
 	}
 
-	// Go through the handlers in order.
-	for _, h := range r.handlers {
-		ok, remainder, val := h.check(path)
+	// Answer CORS preflight requests before any checks can reject them.
+	if ctx.isPreflight() && r.answerPreflight(ctx) {
+		return
+	}
+
+	// Run the global checks.
+	globalChecks, _ := r.globalChecks.Load().([]Check)
+	for _, check := range globalChecks {
+		if err := check(); err != nil {
+			ctx.handleError(err)
+			return
+		}
+	}
+	contextChecks, _ := r.contextChecks.Load().([]func(*Context) error)
+	for _, check := range contextChecks {
+		if err := check(ctx); err != nil {
+			ctx.handleError(err)
+			return
+		}
+	}
+
+	// Go through the handlers in order. Each gets its own context so registrations from routes that didn't consume
+	// the request don't leak into the next.
+	for _, h := range r.loadHandlers() {
+		ok, remainder, val := h.check(req, path)
 		if ok {
 			// This is the route! Proceed with this.
-			ctx.pathRemainder = remainder
-			h.execute(ctx, val)
+			routeCtx := ctx.child(remainder)
+			routeCtx.trace = ctx.trace.with(h, val)
+			h.execute(routeCtx, val)
 			if ctx.consumed {
 				// This route consumed it all.
 				return
@@ -101,11 +662,53 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	// Throw a 404.
+	// Run the fallback if there is one. The path is treated as fully consumed so that methods can be attached.
+	if r.fallback != nil {
+		fallbackCtx := ctx.child(nil)
+		r.fallback(fallbackCtx)
+		fallbackCtx.afterExecute()
+		if ctx.consumed {
+			return
+		}
+	}
+
+	// Throw a 404. If a route matched the path but not the method, say which methods it supports.
 	ctx.pathRemainder = path
+	if ctx.matchedMethods != "" {
+		ctx.w.Header().Set("Allow", ctx.matchedMethods)
+	}
 	ctx.handleError(RouteNotFound)
 }
 
+// Fallback is used to set a handler that runs when no route consumes the request. Methods can be attached to the
+// context as usual (for example, serving index.html for a single page app). If the fallback does not consume the
+// request either, a 404 is thrown.
+func (r *Router) Fallback(hn func(*Context)) {
+	r.fallback = hn
+}
+
+// RequireHTTPS is used to require requests to be made over HTTPS. If redirect is true, HTTP requests are redirected to
+// HTTPS with a 301. Otherwise, they are rejected with the HTTPSRequired error. The X-Forwarded-Proto header is only
+// trusted when the request comes from a known proxy (and auto proxy is not disabled).
+func (r *Router) RequireHTTPS(redirect bool) {
+	r.requireHTTPS = true
+	r.httpsRedirect = redirect
+}
+
+// AllowAbsoluteURI is used to set if requests with an absolute-form request URI (such as
+// "GET http://example.com/path HTTP/1.1", which clients send to forward proxies) are allowed. By default, they are
+// allowed and routed by their path. If they are not allowed, they are rejected with a 400.
+func (r *Router) AllowAbsoluteURI(allow bool) {
+	r.rejectAbsoluteURI = !allow
+}
+
+// SetStrictSlash is used to reject paths with empty segments (such as "/users//5") with a 400. By default, empty
+// segments are skipped, so "/users//5" is routed the same as "/users/5". Trailing slashes are not affected by this
+// either way: "/users/5/" only matches routes that consume the trailing slash.
+func (r *Router) SetStrictSlash(strict bool) {
+	r.strictSlash = strict
+}
+
 // DisableAutoProxy is used to turn off transforming trusted proxy servers into the real IP.
 func (r *Router) DisableAutoProxy() {
 	r.disableAutoProxy = true
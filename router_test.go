@@ -0,0 +1,130 @@
+package discobolt
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Registers routes, groups, and checks from many goroutines whilst serving. Run with -race to catch unsafe access.
+func TestRouter_ConcurrentRegistration(t *testing.T) {
+	r := &Router{}
+	Static(r, "ping", func(ctx *Context) {
+		GET(ctx, func() (string, error) {
+			return "pong", nil
+		})
+	})
+
+	const registrars = 8
+	const routesEach = 25
+	stop := make(chan struct{})
+	var serving sync.WaitGroup
+
+	// Serve requests the whole time routes are being registered. The existing route must always be found.
+	for i := 0; i < 4; i++ {
+		serving.Add(1)
+		go func(i int) {
+			defer serving.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest("GET", "/ping", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("expected 200 from existing route, got %d", w.Code)
+					return
+				}
+				w = httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/r%d-%d", i, n%routesEach), nil))
+			}
+		}(i)
+	}
+
+	var registering sync.WaitGroup
+	for i := 0; i < registrars; i++ {
+		registering.Add(1)
+		go func(i int) {
+			defer registering.Done()
+			for j := 0; j < routesEach; j++ {
+				path := fmt.Sprintf("r%d-%d", i, j)
+				Static(r, path, func(ctx *Context) {
+					GET(ctx, func() (string, error) {
+						return path, nil
+					})
+				})
+				r.AddGlobalCheck(func() error {
+					return nil
+				})
+			}
+			r.Group(fmt.Sprintf("group%d", i), func(g *RouteGroup) {
+				Static(g, fmt.Sprintf("g%d", i), func(ctx *Context) {
+					GET(ctx, func() (string, error) {
+						return "group", nil
+					})
+				})
+			})
+		}(i)
+	}
+	registering.Wait()
+	close(stop)
+	serving.Wait()
+
+	// Every route registered concurrently must be there.
+	for i := 0; i < registrars; i++ {
+		for j := 0; j < routesEach; j++ {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/r%d-%d", i, j), nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("expected route r%d-%d to be registered, got %d", i, j, w.Code)
+			}
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/g%d", i), nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("expected group route g%d to be registered, got %d", i, w.Code)
+		}
+	}
+}
+
+func TestRouter_StrictSlash(t *testing.T) {
+	tests := []struct {
+		name   string
+		strict bool
+		path   string
+		status int
+	}{
+		{"empty segment", false, "/users//5", http.StatusOK},
+		{"empty segment strict", true, "/users//5", http.StatusBadRequest},
+		{"trailing slash", false, "/users/5/", http.StatusNotFound},
+		{"trailing slash strict", true, "/users/5/", http.StatusNotFound},
+		{"clean path", false, "/users/5", http.StatusOK},
+		{"clean path strict", true, "/users/5", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Router{}
+			r.SetStrictSlash(tt.strict)
+			Static(r, "users", func(ctx *Context) {
+				String(ctx, func(ctx *Context, id string) {
+					GET(ctx, func() (string, error) {
+						return id, nil
+					})
+				})
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusOK && w.Body.String() != `"5"` {
+				t.Errorf("expected the route for user 5, got %s", w.Body.String())
+			}
+		})
+	}
+}
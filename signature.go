@@ -0,0 +1,71 @@
+package discobolt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"strings"
+)
+
+// SignatureOptions is used to define how VerifySignature checks a request.
+type SignatureOptions struct {
+	// Secret is the key used for the HMAC.
+	Secret []byte
+
+	// Hash is used to make the hash for the HMAC. Defaults to sha256.New.
+	Hash func() hash.Hash
+
+	// Header is the name of the header containing the signature. Defaults to X-Signature.
+	Header string
+
+	// Prefix is stripped from the start of the header value (for example, "sha256=" for GitHub).
+	Prefix string
+
+	// Base64 is used to say the signature is base64 encoded rather than hex encoded.
+	Base64 bool
+}
+
+// VerifySignature adds a check that computes a HMAC of the raw request body and compares it against the signature in
+// the header using a constant time comparison. This is used to verify webhooks. If the header is missing or the
+// signature does not match, InvalidSignature is returned (401 Unauthorized by default). On the router, this runs after
+// the global checks.
+func VerifySignature(c RouterOrContext, opts SignatureOptions) {
+	if opts.Hash == nil {
+		opts.Hash = sha256.New
+	}
+	if opts.Header == "" {
+		opts.Header = "X-Signature"
+	}
+
+	c.addContextCheck(func(ctx *Context) error {
+		value := ctx.req.Header.Get(opts.Header)
+		if value == "" || !strings.HasPrefix(value, opts.Prefix) {
+			return InvalidSignature
+		}
+		value = value[len(opts.Prefix):]
+
+		var sig []byte
+		var err error
+		if opts.Base64 {
+			sig, err = base64.StdEncoding.DecodeString(value)
+		} else {
+			sig, err = hex.DecodeString(value)
+		}
+		if err != nil {
+			return InvalidSignature
+		}
+
+		body, err := ctx.RawBody()
+		if err != nil {
+			return err
+		}
+		mac := hmac.New(opts.Hash, opts.Secret)
+		_, _ = mac.Write(body)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return InvalidSignature
+		}
+		return nil
+	})
+}
@@ -0,0 +1,51 @@
+package discobolt
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamBody_ErrorReachesErrorHandler(t *testing.T) {
+	failed := errors.New("database went away")
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"plain error", failed},
+		{"user facing error", HTTPError{Code: http.StatusTeapot, Message: "short and stout"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled []error
+			r := &Router{}
+			r.SetErrorHandler(func(_ *Context, err error) (any, int) {
+				handled = append(handled, err)
+				return "ignored", http.StatusInternalServerError
+			})
+			Static(r, "export", func(ctx *Context) {
+				GET(ctx, func() (func(io.Writer) error, error) {
+					return func(w io.Writer) error {
+						_, _ = w.Write([]byte("partial"))
+						return tt.err
+					}, nil
+				})
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/export", nil))
+			if w.Code != http.StatusOK || w.Body.String() != "partial" {
+				t.Errorf("expected the partial body to be left as is, got %d %q", w.Code, w.Body.String())
+			}
+			if len(handled) != 1 {
+				t.Fatalf("expected the error handler to be called once, got %d", len(handled))
+			}
+			var streamErr StreamError
+			if !errors.As(handled[0], &streamErr) || !errors.Is(handled[0], tt.err) {
+				t.Errorf("expected a StreamError wrapping %v, got %v", tt.err, handled[0])
+			}
+		})
+	}
+}
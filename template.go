@@ -0,0 +1,58 @@
+package discobolt
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"html/template"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// Template is used to return a html/template with data from a handler. When text/html is requested, the template is
+// executed with the data. If Name is not blank, the template with that name is executed. For other content types
+// (JSON, XML, msgpack, and YAML), the data is sent on its own so the template is never given to the client.
+type Template struct {
+	Tmpl *template.Template
+	Name string
+	Data any
+}
+
+// HTML executes the template to implement the text/html content type.
+func (t Template) HTML() ([]byte, error) {
+	if t.Tmpl == nil {
+		return nil, errors.New("template result has no template")
+	}
+	var buf bytes.Buffer
+	var err error
+	if t.Name == "" {
+		err = t.Tmpl.Execute(&buf, t.Data)
+	} else {
+		err = t.Tmpl.ExecuteTemplate(&buf, t.Name, t.Data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON sends the data on its own for application/json.
+func (t Template) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Data)
+}
+
+// MarshalYAML sends the data on its own for application/yaml.
+func (t Template) MarshalYAML() (any, error) {
+	return t.Data, nil
+}
+
+// MarshalXML sends the data on its own for application/xml.
+func (t Template) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	return e.Encode(t.Data)
+}
+
+// EncodeMsgpack sends the data on its own for application/msgpack.
+func (t Template) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.Encode(t.Data)
+}
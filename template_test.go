@@ -0,0 +1,76 @@
+package discobolt
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type templateData struct {
+	Name string `json:"name" xml:"name" yaml:"name"`
+}
+
+func TestTemplate_DataOnly(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse("<p>secret template {{.Name}}</p>"))
+	r := &Router{}
+	Static(r, "page", func(ctx *Context) {
+		GET(ctx, func() (Template, error) {
+			return Template{Tmpl: tmpl, Data: templateData{Name: "hello"}}, nil
+		})
+	})
+
+	tests := []struct {
+		accept string
+		body   string
+	}{
+		{"text/html", "<p>secret template hello</p>"},
+		{"application/json", `{"name":"hello"}`},
+		{"application/xml", "<templateData><name>hello</name></templateData>"},
+		{"application/yaml", "name: hello\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/page", nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("expected %q, got %q", tt.body, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("application/msgpack", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/page", nil)
+		req.Header.Set("Accept", "application/msgpack")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if bytes.Contains(w.Body.Bytes(), []byte("secret template")) {
+			t.Fatal("expected the template not to be sent")
+		}
+		var got map[string]string
+		if err := msgpack.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("failed to decode msgpack: %v", err)
+		}
+		if got["name"] != "hello" {
+			t.Errorf("expected the data on its own, got %v", got)
+		}
+	})
+}
+
+func TestTemplate_NilTemplate(t *testing.T) {
+	if _, err := (Template{Data: "x"}).HTML(); err == nil || !strings.Contains(err.Error(), "no template") {
+		t.Errorf("expected an error for a nil template, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package discobolt
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SetHandlerTimeout is used to limit how long a request can take to handle. The context of the request gets the
+// deadline, so outbound calls made with it stop in time. If the handler is still running when the time is up, the
+// error handler is given HandlerTimeout (503 Service Unavailable by default), and whatever the handler writes after
+// that is thrown away. The response is buffered until the handler is done, so streaming responses and server push
+// are not available with a timeout. WebSocket upgrades are not affected. 0 turns this off.
+func (r *Router) SetHandlerTimeout(d time.Duration) {
+	r.handlerTimeout = d
+}
+
+// Defines a response writer that buffers the response so that it can be thrown away if the handler times out.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	status   int
+	buf      bytes.Buffer
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.status != 0 {
+		return
+	}
+	w.status = status
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.buf.Write(b)
+}
+
+// Routes the request in another goroutine and sends what it wrote, or a timeout error if it takes too long. Returns
+// the context that the response was sent from.
+func (r *Router) serveWithTimeout(w http.ResponseWriter, req *http.Request, start time.Time) *Context {
+	timeoutCtx, cancel := context.WithTimeout(req.Context(), r.handlerTimeout)
+	defer cancel()
+
+	tw := &timeoutWriter{header: http.Header{}}
+	ctx := r.newContext(tw, req.WithContext(timeoutCtx), start)
+	done := make(chan struct{})
+	panicked := make(chan any, 1)
+	go func() {
+		defer func() {
+			// Only panics the error handling couldn't deal with get here. Pass them on so they aren't lost.
+			if p := recover(); p != nil {
+				panicked <- p
+			}
+		}()
+		r.serve(ctx)
+		close(done)
+	}()
+
+	select {
+	case p := <-panicked:
+		panic(p)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		dst := w.Header()
+		for k, v := range tw.header {
+			dst[k] = v
+		}
+		if tw.status == 0 {
+			tw.status = http.StatusOK
+		}
+		w.WriteHeader(tw.status)
+		_, _ = w.Write(tw.buf.Bytes())
+		return ctx
+	case <-timeoutCtx.Done():
+		tw.mu.Lock()
+		tw.timedOut = true
+		tw.mu.Unlock()
+
+		// The handler might still be using its context, so the error is sent from a new one.
+		errCtx := r.newContext(w, req, start)
+		if req.Context().Err() != nil {
+			// The client went away rather than the handler taking too long.
+			errCtx.handleError(ClientClosedRequest)
+		} else {
+			errCtx.handleError(HandlerTimeout)
+		}
+		return errCtx
+	}
+}
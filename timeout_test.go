@@ -0,0 +1,61 @@
+package discobolt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerTimeout_DeadlinePropagates(t *testing.T) {
+	var (
+		routerDeadline, childDeadline time.Time
+		hasDeadline, childHasDeadline bool
+	)
+	r := &Router{}
+	r.SetHandlerTimeout(time.Second)
+	Static(r, "slow", func(ctx *Context) {
+		GET(ctx, func() (string, error) {
+			routerDeadline, hasDeadline = ctx.Deadline()
+			child, cancel := context.WithTimeout(ctx, time.Hour)
+			defer cancel()
+			childDeadline, childHasDeadline = child.Deadline()
+			return "ok", nil
+		})
+	})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !hasDeadline {
+		t.Fatal("expected the context to have a deadline")
+	}
+	if routerDeadline.Before(start.Add(time.Second)) || routerDeadline.After(time.Now().Add(time.Second)) {
+		t.Errorf("expected the deadline to be the handler timeout after the request, got %v after the start",
+			routerDeadline.Sub(start))
+	}
+	if !childHasDeadline || !childDeadline.Equal(routerDeadline) {
+		t.Errorf("expected the child context to keep the router deadline %v, got %v", routerDeadline, childDeadline)
+	}
+}
+
+func TestHandlerTimeout_NoDeadlineByDefault(t *testing.T) {
+	hasDeadline := true
+	r := &Router{}
+	Static(r, "fast", func(ctx *Context) {
+		GET(ctx, func() (string, error) {
+			_, hasDeadline = ctx.Deadline()
+			return "ok", nil
+		})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/fast", nil))
+	if hasDeadline {
+		t.Error("expected no deadline without a handler timeout")
+	}
+}
@@ -0,0 +1,46 @@
+package discobolt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransformers_StatusOverride(t *testing.T) {
+	tests := []struct {
+		name   string
+		result any
+		status int
+		code   int
+		body   string
+	}{
+		{"nil result", nil, 0, http.StatusNoContent, ""},
+		{"nil result with status", nil, http.StatusAccepted, http.StatusAccepted, `{"data":null}`},
+		{"result", "ok", 0, http.StatusOK, `{"data":"ok"}`},
+		{"result with no content status", "ok", http.StatusNoContent, http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Router{}
+			Static(r, "jobs", func(ctx *Context) {
+				AddResponseTransformer(ctx, func(_ *Context, body any) any {
+					return map[string]any{"data": body}
+				})
+				GET(ctx, func() (any, error) {
+					if tt.status != 0 {
+						ctx.SetStatus(tt.status)
+					}
+					return tt.result, nil
+				})
+			})
+
+			req := httptest.NewRequest("GET", "/jobs", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.code || w.Body.String() != tt.body {
+				t.Errorf("expected %d %q, got %d %q", tt.code, tt.body, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package discobolt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/schema"
+)
+
+// ValidationError is a UserFacingError used when the input is invalid. It maps field names to the problems with them,
+// and is sent with the status 422 in the format {message => "Unprocessable Entity", errors => {field => [messages]}}.
+// Frontends can use this to highlight the fields.
+type ValidationError map[string][]string
+
+// Add adds a message for the field.
+func (v ValidationError) Add(field, message string) {
+	v[field] = append(v[field], message)
+}
+
+// Status returns the HTTP status code.
+func (v ValidationError) Status() int {
+	return http.StatusUnprocessableEntity
+}
+
+// Body returns the body of the error.
+func (v ValidationError) Body() any {
+	return map[string]any{
+		"message": http.StatusText(http.StatusUnprocessableEntity),
+		"errors":  map[string][]string(v),
+	}
+}
+
+// Error implements the error interface.
+func (v ValidationError) Error() string {
+	fields := make([]string, 0, len(v))
+	for field := range v {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field + ": " + strings.Join(v[field], ", ")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// String allows the error to be returned for text/plain.
+func (v ValidationError) String() string {
+	return v.Error()
+}
+
+// ValidationError turns the bad request into a ValidationError if the underlying error says which fields were wrong
+// (such as a JSON field with the wrong type or a query parameter that failed to convert).
+func (b BadRequest) ValidationError() (ValidationError, bool) {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(b.Err, &typeErr) && typeErr.Field != "" {
+		return ValidationError{typeErr.Field: {"must be " + typeErr.Type.String()}}, true
+	}
+
+	var multiErr schema.MultiError
+	if errors.As(b.Err, &multiErr) && len(multiErr) > 0 {
+		v := ValidationError{}
+		for field, err := range multiErr {
+			var convErr schema.ConversionError
+			if errors.As(err, &convErr) {
+				v.Add(field, "must be "+convErr.Type.String())
+			} else {
+				v.Add(field, err.Error())
+			}
+		}
+		return v, true
+	}
+	return nil, false
+}
+
+// Validator is an input that checks itself after it is decoded. If Validate returns an error, the handler is not run.
+// Return a ValidationError to send a 422 with the problems with each field. Other errors are sent as a bad request
+// unless they are a UserFacingError.
+type Validator interface {
+	Validate() error
+}
+
+// Validates the input. Empty validation errors count as passing so that Validate can return one it built up.
+func validateInput(v Validator) error {
+	err := v.Validate()
+	if ve, ok := err.(ValidationError); ok && len(ve) == 0 {
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+	var userErr UserFacingError
+	if !errors.As(err, &userErr) {
+		err = BadRequest{err}
+	}
+	return err
+}
@@ -0,0 +1,199 @@
+package discobolt
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// WebSocketStats is used to define the traffic on a WebSocket connection. It is given to the OnClose function in
+// WebSocketOptions once the handler returns. Only traffic after the upgrade is counted.
+type WebSocketStats struct {
+	// BytesRead and BytesWritten are the bytes sent over the connection, including WebSocket framing.
+	BytesRead    int64
+	BytesWritten int64
+
+	// MessagesRead and MessagesWritten are the data messages sent over the connection. Control messages (ping, pong,
+	// and close) are not counted, and fragmented messages count once.
+	MessagesRead    int64
+	MessagesWritten int64
+
+	// Duration is how long the connection was open for.
+	Duration time.Duration
+}
+
+// Counts the data messages in one direction of a WebSocket connection by following the frame headers.
+type frameCounter struct {
+	header  []byte
+	payload int64
+}
+
+// Gets the size of the frame header if enough of it is known.
+func frameHeaderSize(header []byte) (int, bool) {
+	if len(header) < 2 {
+		return 0, false
+	}
+	size := 2
+	switch header[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if header[1]&0x80 != 0 {
+		// The frame is masked.
+		size += 4
+	}
+	return size, true
+}
+
+// Follows the frames in the bytes and returns the number of data messages that finished.
+func (f *frameCounter) count(b []byte) (messages int64) {
+	for len(b) > 0 {
+		// Skip the payload of the current frame.
+		if f.payload > 0 {
+			n := int64(len(b))
+			if n > f.payload {
+				n = f.payload
+			}
+			b = b[n:]
+			f.payload -= n
+			continue
+		}
+
+		// Read the header a byte at a time since it can be split over reads.
+		f.header = append(f.header, b[0])
+		b = b[1:]
+		size, ok := frameHeaderSize(f.header)
+		if !ok || len(f.header) < size {
+			continue
+		}
+		length := int64(f.header[1] & 0x7f)
+		switch length {
+		case 126:
+			length = int64(f.header[2])<<8 | int64(f.header[3])
+		case 127:
+			length = 0
+			for _, c := range f.header[2:10] {
+				length = length<<8 | int64(c)
+			}
+		}
+		fin := f.header[0]&0x80 != 0
+		opcode := f.header[0] & 0x0f
+		if fin && opcode < 8 {
+			// The last frame of a data message.
+			messages++
+		}
+		f.payload = length
+		f.header = f.header[:0]
+	}
+	return messages
+}
+
+// Defines a connection that counts the traffic over it once counting is turned on. The counters are first so that they
+// are aligned for atomic access on 32-bit platforms.
+type countingConn struct {
+	bytesRead       int64
+	bytesWritten    int64
+	messagesRead    int64
+	messagesWritten int64
+
+	net.Conn
+	counting bool
+	start    time.Time
+	reads    frameCounter
+	writes   frameCounter
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if c.counting {
+		atomic.AddInt64(&c.bytesRead, int64(n))
+		atomic.AddInt64(&c.messagesRead, c.reads.count(b[:n]))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if c.counting {
+		atomic.AddInt64(&c.bytesWritten, int64(n))
+		atomic.AddInt64(&c.messagesWritten, c.writes.count(b[:n]))
+	}
+	return n, err
+}
+
+// Starts counting. This is called once the upgrade is done so the handshake isn't counted.
+func (c *countingConn) startCounting() {
+	c.counting = true
+	c.start = time.Now()
+}
+
+// Gets the traffic counted so far.
+func (c *countingConn) stats() WebSocketStats {
+	return WebSocketStats{
+		BytesRead:       atomic.LoadInt64(&c.bytesRead),
+		BytesWritten:    atomic.LoadInt64(&c.bytesWritten),
+		MessagesRead:    atomic.LoadInt64(&c.messagesRead),
+		MessagesWritten: atomic.LoadInt64(&c.messagesWritten),
+		Duration:        time.Since(c.start),
+	}
+}
+
+// Defines a response writer that gives the upgrader a counting connection when it hijacks the connection.
+type statsHijacker struct {
+	http.ResponseWriter
+
+	conn *countingConn
+}
+
+func (h *statsHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := h.ResponseWriter.(http.Hijacker).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	h.conn = &countingConn{Conn: conn}
+	if brw.Reader.Buffered() == 0 {
+		// Make sure reads and writes go through the counting connection. If the client sent data early, the upgrader
+		// rejects the connection anyway.
+		brw = bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn))
+	}
+	return h.conn, brw, nil
+}
+
+// Defines a connection that pushes the read deadline back whenever data is read, so the read timeout of a WebSocket
+// only closes connections that have gone quiet.
+type idleConn struct {
+	net.Conn
+
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	return n, err
+}
+
+// Defines a response writer that gives the upgrader an idle timeout connection when it hijacks the connection.
+type idleHijacker struct {
+	http.ResponseWriter
+
+	timeout time.Duration
+}
+
+func (h *idleHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := h.ResponseWriter.(http.Hijacker).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	idle := &idleConn{Conn: conn, timeout: h.timeout}
+	if brw.Reader.Buffered() == 0 {
+		brw = bufio.NewReadWriter(bufio.NewReader(idle), bufio.NewWriter(idle))
+	}
+	return idle, brw, nil
+}
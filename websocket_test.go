@@ -0,0 +1,95 @@
+package discobolt
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Starts a server with a WebSocket that reads messages until it fails, then sends how many it read on done.
+func newReadingWebSocketServer(t *testing.T, readTimeout time.Duration, done chan<- int) *httptest.Server {
+	t.Helper()
+	r := &Router{}
+	Static(r, "ws", func(ctx *Context) {
+		WebSocketWithOptions(ctx, nil, WebSocketOptions{ReadTimeout: readTimeout}, func(conn *websocket.Conn) error {
+			n := 0
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					done <- n
+					return nil
+				}
+				n++
+			}
+		})
+	})
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func dialWebSocket(t *testing.T, s *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	return conn
+}
+
+func TestWebSocket_ReadTimeoutExtendedByMessages(t *testing.T) {
+	done := make(chan int, 1)
+	s := newReadingWebSocketServer(t, 200*time.Millisecond, done)
+	conn := dialWebSocket(t, s)
+
+	// Keep sending for well past the timeout without any pings.
+	for i := 0; i < 12; i++ {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+			t.Fatalf("failed to write message %d: %v", i, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	if n := <-done; n != 12 {
+		t.Errorf("expected all 12 messages to be read, got %d", n)
+	}
+	_ = conn.Close()
+}
+
+func TestWebSocket_ReadTimeoutQuietClient(t *testing.T) {
+	done := make(chan int, 1)
+	s := newReadingWebSocketServer(t, 100*time.Millisecond, done)
+	conn := dialWebSocket(t, s)
+	defer conn.Close()
+
+	select {
+	case n := <-done:
+		if n != 0 {
+			t.Errorf("expected no messages, got %d", n)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the quiet connection to time out")
+	}
+}
+
+func TestWebSocket_ReadTimeoutDisabled(t *testing.T) {
+	defaultTimeout := DefaultWebSocketOptions.ReadTimeout
+	DefaultWebSocketOptions.ReadTimeout = 50 * time.Millisecond
+	defer func() { DefaultWebSocketOptions.ReadTimeout = defaultTimeout }()
+
+	done := make(chan int, 1)
+	s := newReadingWebSocketServer(t, -1, done)
+	conn := dialWebSocket(t, s)
+
+	time.Sleep(200 * time.Millisecond)
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	if n := <-done; n != 1 {
+		t.Errorf("expected the message to be read, got %d", n)
+	}
+	_ = conn.Close()
+}